@@ -0,0 +1,63 @@
+package device
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"path"
+
+	"github.com/acoderup/boost/metrics"
+)
+
+// Admin serves the live topology of a device tree, mount it under a prefix with
+// http.StripPrefix or as it is, only the last path element matters:
+//
+//	topology, topology.json  the topology as JSON, with the counters of every device
+//	topology.dot             the topology in Graphviz DOT
+//	tree                     the ASCII tree of Tree
+//	metrics                  every metric of the registry in the Prometheus format
+type Admin struct {
+	root     Device
+	registry *metrics.Registry
+}
+
+var _ http.Handler = (*Admin)(nil)
+
+// NewAdmin serves the tree under root, counters come from r, which is the registry of
+// the Metrics observer, and are left out when r is nil.
+func NewAdmin(root Device, r *metrics.Registry) *Admin {
+	return &Admin{
+		root:     root,
+		registry: r,
+	}
+}
+
+func (a *Admin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch path.Base(r.URL.Path) {
+	case "topology", "topology.json":
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(Topology(a.root, a.registry))
+	case "topology.dot":
+		w.Header().Set("Content-Type", "text/vnd.graphviz")
+		Topology(a.root, a.registry).WriteDOT(w)
+	case "tree":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		io.WriteString(w, Tree(a.root))
+	case "metrics":
+		if a.registry == nil {
+			http.NotFound(w, r)
+			return
+		}
+		a.registry.ServeHTTP(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
@@ -0,0 +1,215 @@
+package device
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/acoderup/boost/encoding"
+	"github.com/acoderup/boost/message"
+)
+
+// Balancer selects one device from a group of devices sharing the same name.
+// Done is called once the selected device has processed the message.
+type Balancer interface {
+	Pick(ctx context.Context, msg *message.Message, devices []Device) Device
+	Done(device Device)
+}
+
+// Keyer lets a device provide a stable identity for consistent hashing, otherwise
+// the device address is used and devices sharing it are told apart by their order.
+type Keyer interface {
+	Key() string
+}
+
+// Forgetter is implemented by balancers keeping state per device, Forget is called
+// once a device leaves its group.
+type Forgetter interface {
+	Forget(device Device)
+}
+
+// KeyFunc extracts the key of a message for consistent hashing, msg is nil when a
+// device is located by name only.
+type KeyFunc func(ctx context.Context, msg *message.Message) string
+
+var defaultBalancer Balancer = Random()
+
+type random struct{}
+
+func Random() Balancer {
+	return random{}
+}
+
+func (random) Pick(_ context.Context, _ *message.Message, devices []Device) Device {
+	return devices[rand.Intn(len(devices))]
+}
+
+func (random) Done(Device) {}
+
+type roundRobin struct {
+	next uint64
+}
+
+func RoundRobin() Balancer {
+	return &roundRobin{}
+}
+
+func (rr *roundRobin) Pick(_ context.Context, _ *message.Message, devices []Device) Device {
+	n := atomic.AddUint64(&rr.next, 1) - 1
+	return devices[n%uint64(len(devices))]
+}
+
+func (*roundRobin) Done(Device) {}
+
+type weighted struct {
+	weight func(Device) int
+}
+
+// Weighted picks devices randomly in proportion to their weights, devices with
+// non-positive weights are never picked unless all of them are.
+func Weighted(weight func(Device) int) Balancer {
+	return &weighted{weight: weight}
+}
+
+func (w *weighted) Pick(_ context.Context, _ *message.Message, devices []Device) Device {
+	weights := make([]int, len(devices))
+	var total int
+	for index, device := range devices {
+		if weight := w.weight(device); weight > 0 {
+			weights[index] = weight
+			total += weight
+		}
+	}
+	if total == 0 {
+		return devices[rand.Intn(len(devices))]
+	}
+
+	n := rand.Intn(total)
+	for index, weight := range weights {
+		if n < weight {
+			return devices[index]
+		}
+		n -= weight
+	}
+	return devices[len(devices)-1]
+}
+
+func (*weighted) Done(Device) {}
+
+type leastInflight struct {
+	inflight sync.Map
+	next     uint64
+}
+
+// LeastInflight picks the device with the fewest messages being processed.
+func LeastInflight() Balancer {
+	return &leastInflight{}
+}
+
+func (li *leastInflight) counter(device Device) *int64 {
+	v, _ := li.inflight.LoadOrStore(device, new(int64))
+	return v.(*int64)
+}
+
+func (li *leastInflight) Pick(_ context.Context, _ *message.Message, devices []Device) Device {
+	offset := int(atomic.AddUint64(&li.next, 1) % uint64(len(devices)))
+	var picked *int64
+	var device Device
+	for index := range devices {
+		d := devices[(offset+index)%len(devices)]
+		counter := li.counter(d)
+		if picked == nil || atomic.LoadInt64(counter) < atomic.LoadInt64(picked) {
+			picked, device = counter, d
+		}
+	}
+	atomic.AddInt64(picked, 1)
+	return device
+}
+
+func (li *leastInflight) Done(device Device) {
+	if v, ok := li.inflight.Load(device); ok {
+		atomic.AddInt64(v.(*int64), -1)
+	}
+}
+
+func (li *leastInflight) Forget(device Device) {
+	li.inflight.Delete(device)
+}
+
+type consistentHash struct {
+	key KeyFunc
+}
+
+// ConsistentHash sticks messages with the same key to the same device, only keys of
+// a leaving device move when the group changes.
+func ConsistentHash(key KeyFunc) Balancer {
+	return &consistentHash{key: key}
+}
+
+func (ch *consistentHash) Pick(ctx context.Context, msg *message.Message, devices []Device) Device {
+	key := ch.key(ctx, msg)
+
+	var device Device
+	var max uint64
+	seen := make(map[string]int, len(devices))
+	for _, d := range devices {
+		id := deviceKey(d)
+		if n := seen[id]; n > 0 {
+			seen[id]++
+			id += "#" + strconv.Itoa(n)
+		} else {
+			seen[id] = 1
+		}
+		h := fnv.New64a()
+		h.Write([]byte(key))
+		h.Write([]byte{0})
+		h.Write([]byte(id))
+		if score := h.Sum64(); device == nil || score > max {
+			device, max = d, score
+		}
+	}
+	return device
+}
+
+func (*consistentHash) Done(Device) {}
+
+func deviceKey(device Device) string {
+	if k, ok := device.(Keyer); ok {
+		return k.Key()
+	}
+	return strings.Join(Addr(device), "/")
+}
+
+// RequestKey takes the key from a top-level field of the request, it works with
+// encodings able to decode into a map such as JSON and YAML.
+func RequestKey(field string) KeyFunc {
+	return func(_ context.Context, msg *message.Message) string {
+		if msg == nil || msg.Encoding == nil {
+			return ""
+		}
+		var fields map[string]interface{}
+		if err := encoding.Unmarshal(msg.Encoding, msg.Data, &fields); err != nil {
+			return ""
+		}
+		v, ok := fields[field]
+		if !ok {
+			return ""
+		}
+		return fmt.Sprint(v)
+	}
+}
+
+// MetadataKey takes the key from the metadata of the message.
+func MetadataKey(key string) KeyFunc {
+	return func(_ context.Context, msg *message.Message) string {
+		if msg == nil {
+			return ""
+		}
+		return msg.Metadata.Get(key)
+	}
+}
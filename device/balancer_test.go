@@ -0,0 +1,166 @@
+package device_test
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/acoderup/boost/device"
+	"github.com/acoderup/boost/encoding"
+	"github.com/acoderup/boost/message"
+	"github.com/acoderup/boost/route"
+	"github.com/acoderup/boost/style"
+)
+
+type Shard struct {
+	*device.Base
+	key     string
+	weight  int
+	counter map[string]int
+}
+
+func newShard(key string, weight int, counter map[string]int) *Shard {
+	return &Shard{Base: device.NewBase(), key: key, weight: weight, counter: counter}
+}
+
+func (s *Shard) String() string {
+	return "Shard"
+}
+
+func (s *Shard) Key() string {
+	return s.key
+}
+
+func (s *Shard) Process(context.Context, *message.Message) error {
+	s.counter[s.key]++
+	return nil
+}
+
+func sendShard(t *testing.T, router *device.Router, room string) {
+	t.Helper()
+	msg := &message.Message{
+		Route:    route.NewChainRoute(nil, style.GoogleChain("/router/shard")),
+		Encoding: e1,
+		Data:     encoding.Encode(e1, map[string]string{"room": room}),
+	}
+	msg.Route = msg.Route.Forward()
+	if err := router.Process(context.Background(), msg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func newShardRouter(balancer device.Balancer, counter map[string]int) *device.Router {
+	router := device.NewRouter("Router")
+	for index := 0; index < 3; index++ {
+		router.Integrate(newShard(fmt.Sprint(index), index, counter))
+	}
+	return router.Balance(balancer, "Shard")
+}
+
+func TestBalancerRoundRobin(t *testing.T) {
+	counter := map[string]int{}
+	router := newShardRouter(device.RoundRobin(), counter)
+	for index := 0; index < 30; index++ {
+		sendShard(t, router, "")
+	}
+	for key, n := range counter {
+		if n != 10 {
+			t.Fatalf("expecting shard %s to get 10 messages, got %d", key, n)
+		}
+	}
+}
+
+func TestBalancerWeighted(t *testing.T) {
+	counter := map[string]int{}
+	router := newShardRouter(device.Weighted(func(d device.Device) int {
+		return d.(*Shard).weight
+	}), counter)
+	for index := 0; index < 300; index++ {
+		sendShard(t, router, "")
+	}
+	if counter["0"] != 0 || counter["2"] <= counter["1"] {
+		t.Fatalf("unexpected weighted distribution %v", counter)
+	}
+}
+
+func TestBalancerConsistentHash(t *testing.T) {
+	counter := map[string]int{}
+	router := newShardRouter(device.ConsistentHash(device.RequestKey("room")), counter)
+	for index := 0; index < 10; index++ {
+		sendShard(t, router, "room-1")
+	}
+	if len(counter) != 1 {
+		t.Fatalf("expecting sticky shard, got %v", counter)
+	}
+
+	for index := 0; index < 100; index++ {
+		sendShard(t, router, fmt.Sprintf("room-%d", index))
+	}
+	if len(counter) != 3 {
+		t.Fatalf("expecting keys spread over shards, got %v", counter)
+	}
+}
+
+func TestBalancerLeastInflight(t *testing.T) {
+	counter := map[string]int{}
+	devices := []device.Device{newShard("0", 1, counter), newShard("1", 1, counter)}
+	balancer := device.LeastInflight()
+
+	ctx := context.Background()
+	busy := balancer.Pick(ctx, nil, devices)
+	for index := 0; index < 5; index++ {
+		d := balancer.Pick(ctx, nil, devices)
+		if d == busy {
+			t.Fatal("expecting the idle device to be picked")
+		}
+		balancer.Done(d)
+	}
+	balancer.Done(busy)
+}
+
+func TestBalancerLeastInflightShrink(t *testing.T) {
+	counter := map[string]int{}
+	router := newShardRouter(device.LeastInflight(), counter)
+	ctx := context.Background()
+
+	// A device leaving with messages in flight comes back idle
+	busy, _ := router.Select(ctx, "Shard", nil)
+	router.Shrink(busy)
+	router.Extend(busy)
+	var picked bool
+	for index := 0; index < 3; index++ {
+		d, done := router.Select(ctx, "Shard", nil)
+		picked = picked || d == busy
+		done()
+	}
+	if !picked {
+		t.Fatal("expecting the device to be forgotten once it left")
+	}
+}
+
+func TestBalancerConsistentHashAddress(t *testing.T) {
+	// Devices without keys are told apart by address and order, so routers built alike
+	// agree on where keys go
+	newReplicas := func() []device.Device {
+		router := device.NewRouter("Router")
+		for index := 0; index < 3; index++ {
+			router.Integrate(device.NewRouter("Replica"))
+		}
+		return router.Members("Replica")
+	}
+	balancer := device.ConsistentHash(device.MetadataKey("room"))
+	a, b := newReplicas(), newReplicas()
+	spread := map[int]bool{}
+	for index := 0; index < 30; index++ {
+		msg := &message.Message{Metadata: message.Metadata{"room": fmt.Sprint(index)}}
+		i := slices.Index(a, balancer.Pick(context.Background(), msg, a))
+		if j := slices.Index(b, balancer.Pick(context.Background(), msg, b)); i != j {
+			t.Fatalf("expecting room %d on replica %d, got %d", index, i, j)
+		}
+		spread[i] = true
+	}
+	if len(spread) != 3 {
+		t.Fatalf("expecting keys spread over replicas, got %v", spread)
+	}
+}
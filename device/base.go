@@ -2,17 +2,23 @@ package device
 
 import (
 	"context"
-	"math/rand"
+	"slices"
 	"sync"
 
 	"github.com/acoderup/boost/magic"
 	"github.com/acoderup/boost/message"
+	"github.com/acoderup/boost/route"
 )
 
 type Base struct {
-	devices map[string][]Device
-	gateway Device
-	rwMutex sync.RWMutex
+	devices   map[string][]Device
+	gateway   Device
+	rwMutex   sync.RWMutex
+	balancer  Balancer
+	balancers map[string]Balancer
+	version   string
+	versions  map[string]string
+	patterns  []string
 }
 
 var _ Device = (*Base)(nil)
@@ -44,25 +50,239 @@ func (b *Base) Extend(device Device) {
 	b.rwMutex.Lock()
 	defer b.rwMutex.Unlock()
 
+	b.extend(device)
+}
+
+// extend adds device to its group, the caller holds the lock.
+func (b *Base) extend(device Device) {
 	name := device.String()
 
 	for _, d := range b.devices[name] {
-		if d == device {
+		if unwrap(d) == unwrap(device) {
 			return
 		}
 	}
+	if _, ok := b.devices[name]; !ok && route.IsPattern(name) {
+		// Parameters are tried before the wildcard
+		if name == route.Wildcard {
+			b.patterns = append(b.patterns, name)
+		} else {
+			b.patterns = append([]string{name}, b.patterns...)
+		}
+	}
 	b.devices[name] = append(b.devices[name], device)
 }
 
-func (b *Base) Locate(name string) Device {
+func (b *Base) Shrink(device Device) {
+	b.rwMutex.Lock()
+	defer b.rwMutex.Unlock()
+
+	name := device.String()
+
+	// Devices are found by themselves or by the guards and versions wrapping them
+	devices := b.devices[name]
+	for index, d := range devices {
+		if unwrap(d) == unwrap(device) {
+			devices = append(devices[:index:index], devices[index+1:]...)
+			balancer, found := b.balancers[name]
+			if !found {
+				balancer = b.balancer
+			}
+			if f, ok := balancer.(Forgetter); ok {
+				f.Forget(d)
+			}
+			break
+		}
+	}
+	if len(devices) == 0 {
+		delete(b.devices, name)
+		b.patterns = slices.DeleteFunc(b.patterns, func(pattern string) bool {
+			return pattern == name
+		})
+	} else {
+		b.devices[name] = devices
+	}
+}
+
+// Balance sets the balancer of the groups called names, or the default balancer of
+// all groups when no name is given.
+func (b *Base) Balance(balancer Balancer, names ...string) {
+	b.rwMutex.Lock()
+	defer b.rwMutex.Unlock()
+
+	if len(names) == 0 {
+		b.balancer = balancer
+		return
+	}
+	if b.balancers == nil {
+		b.balancers = make(map[string]Balancer)
+	}
+	for _, name := range names {
+		b.balancers[name] = balancer
+	}
+}
+
+// DefaultVersion sets the version constraint of messages without version to the groups
+// called names, or to all groups when no name is given, the latest version by default.
+// A malformed constraint fails with ErrVersionConstraint and changes nothing.
+func (b *Base) DefaultVersion(constraint string, names ...string) error {
+	if _, err := ParseVersionConstraint(constraint); err != nil {
+		return err
+	}
+
+	b.rwMutex.Lock()
+	defer b.rwMutex.Unlock()
+
+	if len(names) == 0 {
+		b.version = constraint
+		return nil
+	}
+	if b.versions == nil {
+		b.versions = make(map[string]string)
+	}
+	for _, name := range names {
+		b.versions[name] = constraint
+	}
+	return nil
+}
+
+// Members returns a copy of the group called name.
+func (b *Base) Members(name string) []Device {
+	b.rwMutex.RLock()
+	defer b.rwMutex.RUnlock()
+
+	return append([]Device(nil), b.devices[name]...)
+}
+
+// snapshot returns a copy of the groups, which is safe to walk while devices change.
+func (b *Base) snapshot() map[string][]Device {
 	b.rwMutex.RLock()
 	defer b.rwMutex.RUnlock()
 
+	groups := make(map[string][]Device, len(b.devices))
+	for name, devices := range b.devices {
+		groups[name] = append([]Device(nil), devices...)
+	}
+	return groups
+}
+
+func (b *Base) Locate(name string) Device {
+	device, done := b.Select(context.Background(), name, nil)
+	done()
+	return device
+}
+
+// Select picks a device for msg from the group called name with the balancer of the
+// group, done must be called once the device has processed the message.
+func (b *Base) Select(ctx context.Context, name string, msg *message.Message) (Device, func()) {
+	device, done, _ := b.pick(ctx, name, msg)
+	return device, done
+}
+
+// pick selects among the devices of the version msg asks for, or the default version
+// of the group, and tells why nothing is selected.
+func (b *Base) pick(ctx context.Context, name string, msg *message.Message) (Device, func(), error) {
+	devices, balancer, err := b.group(name, msg)
+	if err != nil {
+		return nil, func() {}, err
+	}
+	device := balancer.Pick(ctx, msg, devices)
+	return device, func() {
+		balancer.Done(device)
+	}, nil
+}
+
+// group returns the devices msg may be routed to under name with its balancer, the
+// group is matched by patterns when name has none, and narrowed to the version.
+func (b *Base) group(name string, msg *message.Message) ([]Device, Balancer, error) {
+	b.rwMutex.RLock()
+	_, ok := b.devices[name]
+	patterns := slices.Clone(b.patterns)
+	b.rwMutex.RUnlock()
+
+	if !ok && len(patterns) > 0 {
+		// Segments without devices of their own are matched by patterns
+		if pattern, matched := b.match(patterns, msg); matched {
+			name = pattern
+			if msg != nil {
+				param, isParam := route.Param(name)
+				if !isParam {
+					param = route.Wildcard
+				}
+				capture(msg, param)
+			}
+		}
+	}
+
+	b.rwMutex.RLock()
 	devices, ok := b.devices[name]
+	balancer, found := b.balancers[name]
+	if !found {
+		balancer = b.balancer
+	}
+	constraint := versionOf(msg)
+	if constraint == "" {
+		if constraint, found = b.versions[name]; !found {
+			constraint = b.version
+		}
+	}
+	b.rwMutex.RUnlock()
+
 	if !ok {
-		return nil
+		return nil, nil, ErrRouteMissingDevice
+	}
+	devices, err := matchVersions(devices, constraint)
+	if err != nil {
+		return nil, nil, err
+	}
+	if balancer == nil {
+		balancer = defaultBalancer
+	}
+	return devices, balancer, nil
+}
+
+// match returns the first of patterns whose devices know the position after the one
+// of msg, so siblings such as "{roomID}" and "{userID}" are told apart by what is
+// under them.
+func (b *Base) match(patterns []string, msg *message.Message) (string, bool) {
+	next, ok := nextPosition(msg)
+	if !ok {
+		return patterns[0], true
+	}
+	for _, pattern := range patterns {
+		for _, device := range b.Members(pattern) {
+			if device.Locate(next) != nil {
+				return pattern, true
+			}
+		}
+	}
+	return "", false
+}
+
+// nextPosition returns the device name after the position of the route of msg.
+func nextPosition(msg *message.Message) (string, bool) {
+	if msg == nil {
+		return "", false
+	}
+	r, ok := msg.Route.(interface {
+		Dst() []string
+		Index() int
+	})
+	if !ok || r.Index()+1 >= len(r.Dst()) {
+		return "", false
+	}
+	return r.Dst()[r.Index()+1], true
+}
+
+type selector interface {
+	Select(ctx context.Context, name string, msg *message.Message) (Device, func())
+}
+
+func selectDevice(ctx context.Context, d Device, name string, msg *message.Message) (Device, func()) {
+	if s, ok := d.(selector); ok {
+		return s.Select(ctx, name, msg)
 	}
-	return devices[rand.Intn(len(devices))]
+	return d.Locate(name), func() {}
 }
 
 func (b *Base) Process(_ context.Context, msg *message.Message) error {
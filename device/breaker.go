@@ -0,0 +1,129 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/acoderup/boost/message"
+	"github.com/acoderup/boost/timex"
+)
+
+var (
+	ErrCircuitOpen = errors.New("circuit breaker is open")
+)
+
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+var breakerStateName = map[BreakerState]string{
+	BreakerClosed:   "closed",
+	BreakerOpen:     "open",
+	BreakerHalfOpen: "half-open",
+}
+
+func (s BreakerState) String() string {
+	if name, ok := breakerStateName[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("breakerState=%d?", int(s))
+}
+
+// CircuitBreaker is a Guard which opens after threshold consecutive errors and rejects
+// messages until cooldown has passed. Then it half-opens and lets one message through,
+// whose result closes or opens it again.
+type CircuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+	mutex     sync.Mutex
+	state     BreakerState
+	failures  int
+	openedAt  time.Time
+	probing   bool
+}
+
+var _ Guard = (*CircuitBreaker)(nil)
+
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       timex.Now,
+	}
+}
+
+// Clock sets where the time is read from, timex.Now by default.
+func (b *CircuitBreaker) Clock(now func() time.Time) *CircuitBreaker {
+	b.now = now
+	return b
+}
+
+func (b *CircuitBreaker) State() BreakerState {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.halfOpen()
+	return b.state
+}
+
+func (b *CircuitBreaker) Admit(context.Context, *message.Message) (func(error), error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.halfOpen()
+	switch b.state {
+	case BreakerOpen:
+		return nil, ErrCircuitOpen
+	case BreakerHalfOpen:
+		if b.probing {
+			return nil, ErrCircuitOpen
+		}
+		b.probing = true
+	}
+	return b.release, nil
+}
+
+func (b *CircuitBreaker) halfOpen() {
+	if b.state == BreakerOpen && !b.now().Before(b.openedAt.Add(b.cooldown)) {
+		b.state = BreakerHalfOpen
+		b.probing = false
+	}
+}
+
+func (b *CircuitBreaker) release(err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.state == BreakerHalfOpen {
+		b.probing = false
+		if err != nil {
+			b.open()
+		} else {
+			b.state, b.failures = BreakerClosed, 0
+		}
+		return
+	}
+
+	if err == nil {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == BreakerClosed && b.failures >= b.threshold {
+		b.open()
+	}
+}
+
+func (b *CircuitBreaker) open() {
+	b.state = BreakerOpen
+	b.openedAt = b.now()
+	b.failures = 0
+}
@@ -3,20 +3,35 @@ package device
 import (
 	"context"
 	"errors"
+	"fmt"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/acoderup/boost/message"
+	"github.com/acoderup/boost/safe"
 )
 
 var (
 	ErrMissingProcessor = errors.New("processor cannot be found by message ID")
+	ErrRequestCanceled  = errors.New("request is canceled")
+)
+
+const (
+	defaultReapInterval  = 100 * time.Millisecond
+	defaultRequestExpiry = time.Minute
 )
 
 type Processor interface {
 	Process(context.Context, *message.Message) error
 }
 
+// Failer is implemented by processors which want to know why a request failed, such as
+// a *TimeoutError, ErrRequestCanceled or the *Error carried by an error response.
+type Failer interface {
+	Fail(id uint64, err error)
+}
+
 type funcProcessor func(context.Context, *message.Message) error
 
 func NewFuncProcessor(f funcProcessor) funcProcessor {
@@ -27,20 +42,106 @@ func (fp funcProcessor) Process(ctx context.Context, msg *message.Message) error
 	return fp(ctx, msg)
 }
 
+type failProcessor struct {
+	Processor
+	fail func(uint64, error)
+}
+
+// WithFail attaches a failure callback to a processor.
+func WithFail(p Processor, fail func(id uint64, err error)) Processor {
+	return failProcessor{
+		Processor: p,
+		fail:      fail,
+	}
+}
+
+func (fp failProcessor) Fail(id uint64, err error) {
+	fp.fail(id, err)
+}
+
+// TimeoutError is reported to the processor of a request whose deadline has passed.
+type TimeoutError struct {
+	ID       uint64
+	Deadline time.Time
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("request %d timed out at %v", e.ID, e.Deadline)
+}
+
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+func (e *TimeoutError) Is(target error) bool {
+	return target == context.DeadlineExceeded
+}
+
+type ClientStats struct {
+	Outstanding int64
+	Completed   uint64
+	Expired     uint64
+	Canceled    uint64
+}
+
+type pending struct {
+	processor Processor
+	done      <-chan struct{}
+	err       func() error
+	deadline  time.Time
+}
+
 type Client struct {
 	*Base
-	name       string
-	msgID      uint64
-	processors sync.Map
+	name         string
+	msgID        uint64
+	processors   sync.Map
+	fallback     Processor
+	reapInterval time.Duration
+	expiry       time.Duration
+	reaping      int32
+	outstanding  int64
+	completed    uint64
+	expired      uint64
+	canceled     uint64
 }
 
 func NewClient(name string) *Client {
 	return &Client{
-		Base: NewBase(),
-		name: name,
+		Base:         NewBase(),
+		name:         name,
+		reapInterval: defaultReapInterval,
+		expiry:       defaultRequestExpiry,
 	}
 }
 
+// Fallback sets the processor for messages without a processor waiting for them,
+// such as messages pushed by servers.
+func (c *Client) Fallback(p Processor) *Client {
+	c.fallback = p
+	return c
+}
+
+// ReapInterval sets how often pending requests are checked for expiry, a duration
+// which is not positive keeps the default.
+func (c *Client) ReapInterval(d time.Duration) *Client {
+	if d <= 0 {
+		d = defaultReapInterval
+	}
+	c.reapInterval = d
+	return c
+}
+
+// RequestExpiry sets how long requests sent with a context without deadline wait for
+// their reply, a duration which is not positive keeps the default.
+func (c *Client) RequestExpiry(d time.Duration) *Client {
+	if d <= 0 {
+		d = defaultRequestExpiry
+	}
+	c.expiry = d
+	return c
+}
+
 func (c *Client) String() string {
 	return c.name
 }
@@ -56,16 +157,158 @@ func (c *Client) Process(ctx context.Context, msg *message.Message) error {
 }
 
 func (c *Client) localProcess(ctx context.Context, m *message.Message) error {
-	v, ok := c.processors.Load(m.ID)
+	if Streaming(m) {
+		// The processor stays until the stream is ended by its final response
+		if v, ok := c.processors.Load(m.ID); ok {
+			return v.(*pending).processor.Process(ctx, m)
+		}
+	}
+
+	v, ok := c.processors.LoadAndDelete(m.ID)
 	if !ok {
+		if c.fallback != nil {
+			return c.fallback.Process(ctx, m)
+		}
 		return ErrMissingProcessor
 	}
-	c.processors.Delete(m.ID)
-	return v.(Processor).Process(ctx, m)
+	atomic.AddInt64(&c.outstanding, -1)
+	atomic.AddUint64(&c.completed, 1)
+
+	entry := v.(*pending)
+	if f, ok := entry.processor.(Failer); ok {
+		if err := ErrorOf(m); err != nil {
+			f.Fail(m.ID, err)
+			return nil
+		}
+	}
+	return entry.processor.Process(ctx, m)
 }
 
+// Invoke sends m and waits for the reply in the background. The request expires with
+// a *TimeoutError at the deadline of ctx, or after the request expiry when ctx has no
+// deadline, and fails with the error of ctx once ctx is canceled, the ID of m can be
+// used to cancel it explicitly.
 func (c *Client) Invoke(ctx context.Context, m *message.Message, p Processor) error {
+	return c.invoke(ctx, m, p, c.Process)
+}
+
+func (c *Client) invoke(ctx context.Context, m *message.Message, p Processor, process func(context.Context, *message.Message) error) error {
 	m.ID = atomic.AddUint64(&c.msgID, 1)
-	c.processors.Store(m.ID, p)
+	entry := &pending{
+		processor: p,
+		done:      ctx.Done(),
+		err:       ctx.Err,
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		entry.deadline = deadline
+	} else {
+		entry.deadline = time.Now().Add(c.expiry)
+	}
+	c.processors.Store(m.ID, entry)
+	atomic.AddInt64(&c.outstanding, 1)
+	c.reap()
+
+	if err := process(ctx, m); err != nil {
+		if _, ok := c.processors.LoadAndDelete(m.ID); ok {
+			atomic.AddInt64(&c.outstanding, -1)
+		}
+		return err
+	}
+	return nil
+}
+
+// Send sends m without waiting for any reply, such as to a one-way handler. The ID of
+// m is reset to 0, so replies are left to the fallback.
+func (c *Client) Send(ctx context.Context, m *message.Message) error {
+	m.ID = 0
 	return c.Process(ctx, m)
 }
+
+// Cancel fails the pending request with ErrRequestCanceled, it returns false if the
+// request has already been completed.
+func (c *Client) Cancel(id uint64) bool {
+	v, ok := c.processors.LoadAndDelete(id)
+	if !ok {
+		return false
+	}
+	atomic.AddInt64(&c.outstanding, -1)
+	atomic.AddUint64(&c.canceled, 1)
+	c.fail(v.(*pending), id, ErrRequestCanceled)
+	return true
+}
+
+func (c *Client) Stats() ClientStats {
+	return ClientStats{
+		Outstanding: atomic.LoadInt64(&c.outstanding),
+		Completed:   atomic.LoadUint64(&c.completed),
+		Expired:     atomic.LoadUint64(&c.expired),
+		Canceled:    atomic.LoadUint64(&c.canceled),
+	}
+}
+
+func (c *Client) reap() {
+	if !atomic.CompareAndSwapInt32(&c.reaping, 0, 1) {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(c.reapInterval)
+		defer ticker.Stop()
+
+		for now := range ticker.C {
+			c.expire(now)
+			if atomic.LoadInt64(&c.outstanding) > 0 {
+				continue
+			}
+			// Stop when idle, unless a request arrived while stopping.
+			atomic.StoreInt32(&c.reaping, 0)
+			if atomic.LoadInt64(&c.outstanding) == 0 || !atomic.CompareAndSwapInt32(&c.reaping, 0, 1) {
+				return
+			}
+		}
+	}()
+}
+
+func (c *Client) expire(now time.Time) {
+	c.processors.Range(func(key, value any) bool {
+		id, entry := key.(uint64), value.(*pending)
+
+		var err error
+		switch {
+		case !entry.deadline.IsZero() && !now.Before(entry.deadline):
+			err = &TimeoutError{ID: id, Deadline: entry.deadline}
+		case entry.done != nil:
+			select {
+			case <-entry.done:
+				err = entry.err()
+			default:
+				return true
+			}
+		default:
+			return true
+		}
+
+		if _, ok := c.processors.LoadAndDelete(id); !ok {
+			return true
+		}
+		atomic.AddInt64(&c.outstanding, -1)
+		if errors.Is(err, context.DeadlineExceeded) {
+			atomic.AddUint64(&c.expired, 1)
+			if _, ok := err.(*TimeoutError); !ok {
+				err = &TimeoutError{ID: id, Deadline: entry.deadline}
+			}
+		} else {
+			atomic.AddUint64(&c.canceled, 1)
+		}
+		c.fail(entry, id, err)
+		return true
+	})
+}
+
+func (c *Client) fail(entry *pending, id uint64, err error) {
+	if f, ok := entry.processor.(Failer); ok {
+		safe.Default().Do(func() {
+			f.Fail(id, err)
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package device_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/acoderup/boost/device"
+	"github.com/acoderup/boost/message"
+	"github.com/acoderup/boost/route"
+	"github.com/acoderup/boost/style"
+)
+
+func invokeLost(t *testing.T, ctx context.Context, client *device.Client, errChan chan<- error) uint64 {
+	t.Helper()
+	msg := &message.Message{
+		Route:    route.NewChainRoute(device.Addr(client), style.GoogleChain("/shard")),
+		Encoding: e1,
+	}
+	processor := device.WithFail(device.NewFuncProcessor(func(context.Context, *message.Message) error {
+		t.Error("unexpected reply")
+		return nil
+	}), func(_ uint64, err error) {
+		errChan <- err
+	})
+	if err := client.Invoke(ctx, msg, processor); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return msg.ID
+}
+
+func waitFail(t *testing.T, errChan <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-errChan:
+		return err
+	case <-time.After(10 * time.Second):
+		t.Fatal("timeout when waiting for the request to fail")
+		return nil
+	}
+}
+
+func TestClientExpiry(t *testing.T) {
+	client := device.NewClient("Anonymous").ReapInterval(10 * time.Millisecond)
+	device.NewBus().Integrate(client, newShard("lost", 1, map[string]int{}))
+	errChan := make(chan error, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	id := invokeLost(t, ctx, client, errChan)
+
+	err := waitFail(t, errChan)
+	var timeoutErr *device.TimeoutError
+	if !errors.As(err, &timeoutErr) || timeoutErr.ID != id || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expecting timeout error of request %d, got %v", id, err)
+	}
+	if stats := client.Stats(); stats.Outstanding != 0 || stats.Expired != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestClientRequestExpiry(t *testing.T) {
+	client := device.NewClient("Anonymous").ReapInterval(10 * time.Millisecond).RequestExpiry(50 * time.Millisecond)
+	device.NewBus().Integrate(client, newShard("lost", 1, map[string]int{}))
+	errChan := make(chan error, 1)
+
+	// Requests without deadline expire too
+	id := invokeLost(t, context.Background(), client, errChan)
+	var timeoutErr *device.TimeoutError
+	if err := waitFail(t, errChan); !errors.As(err, &timeoutErr) || timeoutErr.ID != id {
+		t.Fatalf("expecting timeout error of request %d, got %v", id, err)
+	}
+	if stats := client.Stats(); stats.Outstanding != 0 || stats.Expired != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestClientReapIntervalDefault(t *testing.T) {
+	client := device.NewClient("Anonymous").ReapInterval(0)
+	device.NewBus().Integrate(client, newShard("lost", 1, map[string]int{}))
+	errChan := make(chan error, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	invokeLost(t, ctx, client, errChan)
+	if err := waitFail(t, errChan); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expecting the default interval to reap, got %v", err)
+	}
+}
+
+func TestClientCancel(t *testing.T) {
+	client := device.NewClient("Anonymous").ReapInterval(10 * time.Millisecond)
+	device.NewBus().Integrate(client, newShard("lost", 1, map[string]int{}))
+	errChan := make(chan error, 1)
+
+	id := invokeLost(t, context.Background(), client, errChan)
+	if stats := client.Stats(); stats.Outstanding != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	if !client.Cancel(id) {
+		t.Fatal("expecting request to be canceled")
+	}
+	if err := waitFail(t, errChan); !errors.Is(err, device.ErrRequestCanceled) {
+		t.Fatalf("expecting canceled error, got %v", err)
+	}
+	if client.Cancel(id) {
+		t.Fatal("expecting request to be canceled only once")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	invokeLost(t, ctx, client, errChan)
+	cancel()
+	if err := waitFail(t, errChan); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expecting context canceled error, got %v", err)
+	}
+	if stats := client.Stats(); stats.Outstanding != 0 || stats.Canceled != 2 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
@@ -0,0 +1,203 @@
+package device
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/acoderup/boost/magic"
+	"github.com/acoderup/boost/message"
+	"github.com/acoderup/boost/safe"
+)
+
+var (
+	ErrConnClosed = errors.New("connection is closed")
+)
+
+const defaultConnWriteTimeout = 10 * time.Second
+
+// Conn is a device which moves messages over a net.Conn with length-prefixed framing.
+// Outgoing messages are written to the peer, incoming messages are delivered to the
+// device located by route position on the gateway.
+type Conn struct {
+	*Base
+	name         string
+	conn         net.Conn
+	writeTimeout time.Duration
+	wMutex       sync.Mutex
+	done         chan struct{}
+	once         sync.Once
+	receive      func(*message.Message)
+	lMutex       sync.Mutex
+	lanes        map[string]*lane
+}
+
+// lane holds the messages waiting for an earlier message with the same key.
+type lane struct {
+	queue []*message.Message
+}
+
+func NewConn(name string, conn net.Conn) *Conn {
+	return &Conn{
+		Base:         NewBase(),
+		name:         name,
+		conn:         conn,
+		writeTimeout: defaultConnWriteTimeout,
+		done:         make(chan struct{}),
+		lanes:        make(map[string]*lane),
+	}
+}
+
+// WriteTimeout sets how long a message may take to be written, so a peer which stops
+// reading fails senders instead of blocking them. A duration which is not positive
+// keeps the default.
+func (c *Conn) WriteTimeout(d time.Duration) *Conn {
+	if d <= 0 {
+		d = defaultConnWriteTimeout
+	}
+	c.writeTimeout = d
+	return c
+}
+
+func (c *Conn) String() string {
+	return c.name
+}
+
+func (c *Conn) Process(ctx context.Context, msg *message.Message) error {
+	if !msg.Route.Dispatching() {
+		if c.gateway == nil {
+			return ErrGatewayNotFound
+		}
+		return c.gateway.Process(ctx, msg)
+	}
+	return c.Send(msg)
+}
+
+func (c *Conn) Send(msg *message.Message) error {
+	payload, err := message.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	c.wMutex.Lock()
+	defer c.wMutex.Unlock()
+
+	select {
+	case <-c.done:
+		return ErrConnClosed
+	default:
+	}
+	if err := c.conn.SetWriteDeadline(time.Now().Add(c.writeTimeout)); err != nil {
+		c.Close()
+		return err
+	}
+	if err := writeFrame(c.conn, payload); err != nil {
+		c.Close()
+		return err
+	}
+	return nil
+}
+
+// Serve reads messages until the connection is closed. Messages are processed in their
+// own goroutines so slow handlers never block the connection, while messages with the
+// same ID and route, such as the responses of a stream, are delivered in order.
+func (c *Conn) Serve(ctx context.Context) error {
+	defer c.Close()
+
+	reader := bufio.NewReader(c.conn)
+	for {
+		payload, err := readFrame(reader)
+		if err != nil {
+			select {
+			case <-c.done:
+				return nil
+			default:
+				return err
+			}
+		}
+
+		msg, err := message.Unmarshal(payload)
+		if err != nil {
+			return err
+		}
+
+		if c.receive != nil {
+			c.receive(msg)
+		}
+		c.dispatch(ctx, msg)
+	}
+}
+
+func (c *Conn) dispatch(ctx context.Context, msg *message.Message) {
+	if msg.ID == 0 {
+		go safe.Default().Do(func() error {
+			return c.deliver(ctx, msg)
+		})
+		return
+	}
+
+	key := laneKey(msg)
+	c.lMutex.Lock()
+	if l, ok := c.lanes[key]; ok {
+		l.queue = append(l.queue, msg)
+		c.lMutex.Unlock()
+		return
+	}
+	l := &lane{}
+	c.lanes[key] = l
+	c.lMutex.Unlock()
+
+	go func() {
+		for {
+			safe.Default().Do(func() error {
+				return c.deliver(ctx, msg)
+			})
+
+			c.lMutex.Lock()
+			if len(l.queue) == 0 {
+				delete(c.lanes, key)
+				c.lMutex.Unlock()
+				return
+			}
+			msg, l.queue = l.queue[0], l.queue[1:]
+			c.lMutex.Unlock()
+		}
+	}()
+}
+
+func laneKey(msg *message.Message) string {
+	if r, ok := msg.Route.(addressed); ok {
+		return fmt.Sprintf("%d %s %s", msg.ID, strings.Join(r.Src(), magic.SeparatorSlash), strings.Join(r.Dst(), magic.SeparatorSlash))
+	}
+	return fmt.Sprintf("%d %s", msg.ID, msg.Route)
+}
+
+func (c *Conn) deliver(ctx context.Context, msg *message.Message) error {
+	if c.gateway == nil {
+		return ErrGatewayNotFound
+	}
+	device, done := selectDevice(ctx, c.gateway, msg.Route.Position(), msg)
+	if device == nil {
+		return msg.Route.Error(ErrRouteMissingDevice)
+	}
+	defer done()
+	return device.Process(ctx, msg)
+}
+
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *Conn) Close() error {
+	var err error
+	c.once.Do(func() {
+		close(c.done)
+		err = c.conn.Close()
+	})
+	return err
+}
@@ -1,7 +1,71 @@
 package device
 
+import (
+	"context"
+
+	"github.com/acoderup/boost/message"
+	"github.com/acoderup/boost/route"
+)
+
 type ContextKey string
 
 const (
-	ContextRequest ContextKey = "Request"
+	ContextRequest  ContextKey = "Request"
+	ContextMetadata ContextKey = "Metadata"
+	ContextParams   ContextKey = "Params"
 )
+
+// RequestFrom returns the request message being handled.
+func RequestFrom(ctx context.Context) *message.Message {
+	msg, _ := ctx.Value(ContextRequest).(*message.Message)
+	return msg
+}
+
+// MetadataFrom returns the metadata of the request message being handled.
+func MetadataFrom(ctx context.Context) message.Metadata {
+	md, _ := ctx.Value(ContextMetadata).(message.Metadata)
+	return md
+}
+
+// CallerFrom returns the address of the device which sent the request being handled,
+// server code keeps it to push messages to the caller later.
+func CallerFrom(ctx context.Context) []string {
+	msg := RequestFrom(ctx)
+	if msg == nil {
+		return nil
+	}
+	if r, ok := msg.Route.(addressed); ok {
+		return r.Src()
+	}
+	return nil
+}
+
+// ParamsFrom returns the path parameters of the request being handled, captured by
+// devices named like "{roomID}" along a route.PathRoute.
+func ParamsFrom(ctx context.Context) map[string]string {
+	params, _ := ctx.Value(ContextParams).(map[string]string)
+	return params
+}
+
+// ParamFrom returns a path parameter of the request being handled.
+func ParamFrom(ctx context.Context, name string) string {
+	return ParamsFrom(ctx)[name]
+}
+
+// addressed is implemented by routes between device addresses, such as chain and path
+// routes.
+type addressed interface {
+	Src() []string
+	Dst() []string
+}
+
+type capturer interface {
+	Capture(name string) route.Route
+}
+
+// capture keeps the segment at the position of the route of msg as a path parameter.
+func capture(msg *message.Message, name string) {
+	if c, ok := msg.Route.(capturer); ok {
+		msg.Route = c.Capture(name)
+	}
+}
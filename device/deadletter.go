@@ -0,0 +1,169 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/acoderup/boost/message"
+	"github.com/acoderup/boost/route"
+	"github.com/acoderup/boost/timex"
+)
+
+var (
+	ErrRouteHopLimit = errors.New("route has exceeded its hop limit")
+)
+
+const defaultDeadLetterCapacity = 1024
+
+// DeadLetter is a message which cannot be delivered, with the route as it was when
+// delivery failed.
+type DeadLetter struct {
+	Message *message.Message
+	Reason  error
+	Route   string
+	Router  string
+	Time    time.Time
+}
+
+// DeadLetterSink receives messages which cannot be delivered.
+type DeadLetterSink interface {
+	Put(DeadLetter)
+}
+
+// DeadLetters keeps the latest dead letters in memory, the oldest are dropped once
+// the capacity is reached.
+type DeadLetters struct {
+	mutex    sync.Mutex
+	letters  []DeadLetter
+	capacity int
+	dropped  uint64
+}
+
+func NewDeadLetters(capacity int) *DeadLetters {
+	if capacity <= 0 {
+		capacity = defaultDeadLetterCapacity
+	}
+	return &DeadLetters{
+		capacity: capacity,
+	}
+}
+
+func (d *DeadLetters) Put(letter DeadLetter) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if len(d.letters) == d.capacity {
+		d.letters = append(d.letters[:0], d.letters[1:]...)
+		d.dropped++
+	}
+	d.letters = append(d.letters, letter)
+}
+
+// Letters returns the dead letters kept, from the oldest.
+func (d *DeadLetters) Letters() []DeadLetter {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return append([]DeadLetter(nil), d.letters...)
+}
+
+func (d *DeadLetters) Len() int {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return len(d.letters)
+}
+
+// Dropped returns how many letters have been dropped for the capacity.
+func (d *DeadLetters) Dropped() uint64 {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return d.dropped
+}
+
+// Drain removes the letters accepted by filter and returns them, a nil filter accepts
+// every letter.
+func (d *DeadLetters) Drain(filter func(DeadLetter) bool) []DeadLetter {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	var drained []DeadLetter
+	kept := d.letters[:0]
+	for _, letter := range d.letters {
+		if filter == nil || filter(letter) {
+			drained = append(drained, letter)
+		} else {
+			kept = append(kept, letter)
+		}
+	}
+	clear(d.letters[len(kept):])
+	d.letters = kept
+	return drained
+}
+
+// Reinject drains the letters accepted by filter and sends them from the source again
+// through bus, letters failing again are sunk again.
+func (d *DeadLetters) Reinject(ctx context.Context, bus Device, filter func(DeadLetter) bool) error {
+	var errs []error
+	for _, letter := range d.Drain(filter) {
+		msg := *letter.Message
+		switch r := msg.Route.(type) {
+		case route.ChainRoute:
+			msg.Route = r.Rewind()
+		case *route.ChainRoute:
+			msg.Route = r.Rewind()
+		}
+		if err := bus.Process(ctx, &msg); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// DeadLetters sets where the messages which cannot be delivered by the router and the
+// routers under it are put, it is usually set on the bus.
+func (r *Router) DeadLetters(sink DeadLetterSink) *Router {
+	r.deadLetters = sink
+	return r
+}
+
+// undeliverable puts msg into the dead letter sink of the nearest router, and returns
+// reason wrapped by the route.
+func (r *Router) undeliverable(msg *message.Message, reason error) error {
+	err := msg.Route.Error(reason)
+	for d := Device(r); d != nil; d = d.Gateway() {
+		router, ok := unwrap(d).(*Router)
+		if !ok || router.deadLetters == nil {
+			continue
+		}
+
+		letter := *msg
+		letter.Metadata = msg.Metadata.Clone()
+		router.deadLetters.Put(DeadLetter{
+			Message: &letter,
+			Reason:  reason,
+			Route:   msg.Route.String(),
+			Router:  RoutePath(r),
+			Time:    timex.Now(),
+		})
+		break
+	}
+	return err
+}
+
+type hopper interface {
+	Hop() (route.Route, bool)
+}
+
+// hop counts a hop of msg, it fails once the route has exceeded its hop limit.
+func hop(msg *message.Message) bool {
+	h, ok := msg.Route.(hopper)
+	if !ok {
+		return true
+	}
+	msg.Route, ok = h.Hop()
+	return ok
+}
@@ -0,0 +1,89 @@
+package device_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/acoderup/boost/device"
+	"github.com/acoderup/boost/message"
+	"github.com/acoderup/boost/route"
+	"github.com/acoderup/boost/style"
+)
+
+// Loop sends every message back to the bus, like a misconfigured gateway.
+type Loop struct {
+	*device.Base
+}
+
+func (l *Loop) String() string {
+	return "Loop"
+}
+
+func (l *Loop) Process(ctx context.Context, msg *message.Message) error {
+	r := msg.Route.(route.ChainRoute)
+	msg.Route = route.MakeChainRoute(r.Src(), r.Dst(), 0).WithHops(r.Hops()).WithHopLimit(r.HopLimit())
+	return l.Gateway().Process(ctx, msg)
+}
+
+func TestDeadLetters(t *testing.T) {
+	letters := device.NewDeadLetters(0)
+	replies := make(chan *message.Message, 1)
+	client := device.NewClient("Anonymous").Fallback(device.NewFuncProcessor(func(_ context.Context, msg *message.Message) error {
+		replies <- msg
+		return nil
+	}))
+	game := device.NewRouter("Game")
+	bus := device.NewBus().DeadLetters(letters).Integrate(client, game)
+
+	msg := &message.Message{
+		Route:    route.NewChainRoute(device.Addr(client), style.GoogleChain("/game/try/echo")),
+		Encoding: e1,
+		Data:     []byte(`{"Text":"again"}`),
+	}
+	if err := client.Send(context.Background(), msg); !errors.Is(err, device.ErrRouteMissingDevice) {
+		t.Fatalf("expecting missing device error, got %v", err)
+	}
+	if letters.Len() != 1 {
+		t.Fatalf("expecting 1 dead letter, got %d", letters.Len())
+	}
+	letter := letters.Letters()[0]
+	if !errors.Is(letter.Reason, device.ErrRouteMissingDevice) || letter.Router != "/Game" || letter.Route != "[Bus:Anonymous] -> [:Game:<Try>:Echo]" {
+		t.Fatalf("unexpected dead letter %+v", letter)
+	}
+
+	game.Integrate(device.NewRouter("Try").Integrate(&Try{logChan: make(chan string, 1)}))
+	if err := letters.Reinject(context.Background(), bus, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pong := &Pong{}
+	if err := e1.Unmarshal((<-replies).Data, pong); err != nil || pong.Text != "again" {
+		t.Fatalf("unexpected reply %+v: %v", pong, err)
+	}
+	if letters.Len() != 0 {
+		t.Fatalf("expecting letters to be drained, got %d", letters.Len())
+	}
+}
+
+func TestHopLimit(t *testing.T) {
+	letters := device.NewDeadLetters(1)
+	bus := device.NewBus().DeadLetters(letters).Integrate(&Loop{Base: device.NewBase()})
+
+	msg := &message.Message{
+		Route: route.NewChainRoute(nil, style.GoogleChain("/loop")).WithHopLimit(8),
+	}
+	if err := bus.Process(context.Background(), msg); !errors.Is(err, device.ErrRouteHopLimit) {
+		t.Fatalf("expecting hop limit error, got %v", err)
+	}
+	if hops := letters.Letters()[0].Message.Route.(route.ChainRoute).Hops(); hops != 9 {
+		t.Fatalf("expecting the 9th hop to fail, got %d", hops)
+	}
+
+	msg.Route = route.NewChainRoute(nil, style.GoogleChain("/loop"))
+	if err := bus.Process(context.Background(), msg); !errors.Is(err, device.ErrRouteHopLimit) {
+		t.Fatalf("expecting hop limit error, got %v", err)
+	}
+	if letters.Len() != 1 || letters.Dropped() != 1 {
+		t.Fatalf("expecting the oldest letter to be dropped, got %d letters", letters.Len())
+	}
+}
@@ -25,13 +25,13 @@ type Device interface {
 	Process(context.Context, *message.Message) error
 }
 
+// Tree renders the devices under device sorted by name, it is safe to call while
+// devices join and leave.
 func Tree(device Device) string {
 	var add = func(d Device, t gotree.Tree) {}
 	add = func(d Device, t gotree.Tree) {
-		for _, deviceGroup := range d.Devices() {
-			for _, device := range deviceGroup {
-				add(device, t.Add(device.String()))
-			}
+		for _, device := range children(d) {
+			add(device, t.Add(device.String()))
 		}
 	}
 
@@ -52,3 +52,27 @@ func Addr(device Device) []string {
 	}
 	return addr
 }
+
+type grouper interface {
+	Members(name string) []Device
+}
+
+// groupOf returns a copy of the group called name under d.
+func groupOf(d Device, name string) []Device {
+	if g, ok := d.(grouper); ok {
+		return g.Members(name)
+	}
+	return append([]Device(nil), d.Devices()[name]...)
+}
+
+// unwrap returns the device wrapped by guards, versions and other wrappers such as
+// recorders.
+func unwrap(d Device) Device {
+	for {
+		u, ok := d.(interface{ Unwrap() Device })
+		if !ok {
+			return d
+		}
+		d = u.Unwrap()
+	}
+}
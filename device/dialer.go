@@ -0,0 +1,207 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/acoderup/boost/message"
+	"github.com/acoderup/boost/safe"
+)
+
+var (
+	ErrDialerAnonymous = errors.New("dialer has not announced its peer name")
+)
+
+// defaultInflightExpiry bounds how long a message without a deadline is counted in
+// flight, one-way messages are never replied to.
+const defaultInflightExpiry = time.Minute
+
+type DialFunc func(context.Context) (net.Conn, error)
+
+// Dialer is the connecting side of a process spanning connection. It stands in the
+// local tree for the remote device called name, and redials whenever the connection
+// has been lost. It must Announce its peer name before sending, since the listener
+// replaces a connection by another one of the same name.
+type Dialer struct {
+	*Base
+	name     string
+	peer     string
+	dial     DialFunc
+	mutex    sync.Mutex
+	conn     *Conn
+	inflight sync.Map
+	expired  int64
+	lost     uint64
+}
+
+func NewDialer(name, network, address string) *Dialer {
+	dialer := &net.Dialer{}
+	return NewDialerFunc(name, func(ctx context.Context) (net.Conn, error) {
+		return dialer.DialContext(ctx, network, address)
+	})
+}
+
+func NewDialerFunc(name string, dial DialFunc) *Dialer {
+	return &Dialer{
+		Base: NewBase(),
+		name: name,
+		dial: dial,
+	}
+}
+
+// Announce sets the name the listener registers this connection under, it should be
+// the name of the local device waiting for responses.
+func (d *Dialer) Announce(peer string) *Dialer {
+	d.peer = peer
+	return d
+}
+
+func (d *Dialer) String() string {
+	return d.name
+}
+
+func (d *Dialer) Process(ctx context.Context, msg *message.Message) error {
+	if !msg.Route.Dispatching() {
+		if d.gateway == nil {
+			return ErrGatewayNotFound
+		}
+		return d.gateway.Process(ctx, msg)
+	}
+	return d.send(ctx, msg)
+}
+
+func (d *Dialer) send(ctx context.Context, msg *message.Message) error {
+	conn, err := d.connect(ctx)
+	if err != nil {
+		return err
+	}
+	d.expire(time.Now())
+	if msg.ID != 0 {
+		expiry, ok := ctx.Deadline()
+		if !ok {
+			expiry = time.Now().Add(defaultInflightExpiry)
+		}
+		d.inflight.Store(msg.ID, expiry)
+	}
+	if err = conn.Send(msg); err == nil {
+		return nil
+	}
+
+	// The connection may have gone stale since the last message, so redial once.
+	conn, err = d.connect(ctx)
+	if err != nil {
+		d.inflight.Delete(msg.ID)
+		return err
+	}
+	if err = conn.Send(msg); err != nil {
+		d.inflight.Delete(msg.ID)
+		return err
+	}
+	return nil
+}
+
+func (d *Dialer) connect(ctx context.Context) (*Conn, error) {
+	if d.peer == "" {
+		return nil, ErrDialerAnonymous
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.conn != nil {
+		select {
+		case <-d.conn.Done():
+			d.conn = nil
+		default:
+			return d.conn, nil
+		}
+	}
+
+	nc, err := d.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err = writeFrame(nc, []byte(d.peer)); err != nil {
+		nc.Close()
+		return nil, err
+	}
+
+	conn := NewConn(d.name, nc)
+	conn.Join(d.Gateway())
+	conn.receive = func(msg *message.Message) {
+		if !Streaming(msg) {
+			d.inflight.Delete(msg.ID)
+		}
+	}
+	d.conn = conn
+
+	go safe.Default().Do(func() error {
+		defer d.drop(conn)
+		return conn.Serve(context.Background())
+	})
+	return conn, nil
+}
+
+func (d *Dialer) drop(conn *Conn) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.conn != nil && d.conn != conn {
+		return
+	}
+	d.conn = nil
+	d.inflight.Range(func(key, _ any) bool {
+		d.inflight.Delete(key)
+		atomic.AddUint64(&d.lost, 1)
+		return true
+	})
+}
+
+// expire forgets the in-flight messages which have expired, at most once a second.
+func (d *Dialer) expire(now time.Time) {
+	last := atomic.LoadInt64(&d.expired)
+	if now.UnixNano()-last < int64(time.Second) || !atomic.CompareAndSwapInt64(&d.expired, last, now.UnixNano()) {
+		return
+	}
+	d.inflight.Range(func(key, value any) bool {
+		if now.After(value.(time.Time)) {
+			d.inflight.Delete(key)
+		}
+		return true
+	})
+}
+
+// Inflight returns the number of messages sent and still waiting for a reply, messages
+// are no longer counted once they expire.
+func (d *Dialer) Inflight() int {
+	now := time.Now()
+	var n int
+	d.inflight.Range(func(_, value any) bool {
+		if !now.After(value.(time.Time)) {
+			n++
+		}
+		return true
+	})
+	return n
+}
+
+// Lost returns the number of in-flight messages dropped by lost connections.
+func (d *Dialer) Lost() uint64 {
+	return atomic.LoadUint64(&d.lost)
+}
+
+func (d *Dialer) Close() error {
+	d.mutex.Lock()
+	conn := d.conn
+	d.conn = nil
+	d.mutex.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+	return conn.Close()
+}
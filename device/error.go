@@ -0,0 +1,168 @@
+package device
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/acoderup/boost/encoding"
+	"github.com/acoderup/boost/message"
+)
+
+type ErrorCode int
+
+const (
+	CodeUnknown ErrorCode = iota
+	CodeInvalidArgument
+	CodeNotFound
+	CodeAlreadyExists
+	CodePermissionDenied
+	CodeUnauthenticated
+	CodeResourceExhausted
+	CodeFailedPrecondition
+	CodeDeadlineExceeded
+	CodeCanceled
+	CodeUnavailable
+	CodeInternal
+)
+
+var errorCodeName = map[ErrorCode]string{
+	CodeUnknown:            "unknown",
+	CodeInvalidArgument:    "invalid argument",
+	CodeNotFound:           "not found",
+	CodeAlreadyExists:      "already exists",
+	CodePermissionDenied:   "permission denied",
+	CodeUnauthenticated:    "unauthenticated",
+	CodeResourceExhausted:  "resource exhausted",
+	CodeFailedPrecondition: "failed precondition",
+	CodeDeadlineExceeded:   "deadline exceeded",
+	CodeCanceled:           "canceled",
+	CodeUnavailable:        "unavailable",
+	CodeInternal:           "internal",
+}
+
+func (c ErrorCode) String() string {
+	if s, ok := errorCodeName[c]; ok {
+		return s
+	}
+	return fmt.Sprintf("errorCode=%d?", int(c))
+}
+
+// Error is the envelope of an error travelling back to the caller as a response
+// message, it is encoded with the encoding of the request.
+type Error struct {
+	Code      ErrorCode         `json:"code" yaml:"code" xml:"code"`
+	Message   string            `json:"message" yaml:"message" xml:"message"`
+	Details   map[string]string `json:"details,omitempty" yaml:"details,omitempty" xml:"-"`
+	Retryable bool              `json:"retryable,omitempty" yaml:"retryable,omitempty" xml:"retryable,omitempty"`
+}
+
+func NewError(code ErrorCode, format string, args ...interface{}) *Error {
+	return &Error{
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%v: %s", e.Code, e.Message)
+}
+
+func (e *Error) WithDetail(key, value string) *Error {
+	if e.Details == nil {
+		e.Details = make(map[string]string)
+	}
+	e.Details[key] = value
+	return e
+}
+
+func (e *Error) WithRetryable() *Error {
+	e.Retryable = true
+	return e
+}
+
+// AsError converts any error into an envelope, well-known errors get their codes.
+func AsError(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+
+	var code ErrorCode
+	var retryable bool
+	switch {
+	case errors.Is(err, ErrHandlerInvalidRequest), errors.Is(err, ErrVersionConstraint):
+		code = CodeInvalidArgument
+	case errors.Is(err, ErrRouteMissingDevice), errors.Is(err, ErrRouteDeadEnd), errors.Is(err, ErrVersionNotFound):
+		code = CodeNotFound
+	case errors.Is(err, context.DeadlineExceeded):
+		code, retryable = CodeDeadlineExceeded, true
+	case errors.Is(err, context.Canceled), errors.Is(err, ErrRequestCanceled):
+		code = CodeCanceled
+	case errors.Is(err, ErrRateLimited), errors.Is(err, ErrConcurrencyLimited), errors.Is(err, ErrMailboxFull):
+		code, retryable = CodeResourceExhausted, true
+	case errors.Is(err, ErrCircuitOpen):
+		code, retryable = CodeUnavailable, true
+	case errors.Is(err, ErrHandlerPanic):
+		code = CodeInternal
+	default:
+		code = CodeUnknown
+	}
+	return &Error{
+		Code:      code,
+		Message:   err.Error(),
+		Retryable: retryable,
+	}
+}
+
+// errorMessage builds the response carrying err to the caller of reqMsg.
+func errorMessage(reqMsg *message.Message, err error) (*message.Message, error) {
+	envelope := AsError(err)
+
+	respMsg := &message.Message{
+		ID:       reqMsg.ID,
+		Route:    reqMsg.Route.Reverse(),
+		Encoding: reqMsg.Encoding.Reverse(),
+		Metadata: reqMsg.Metadata.Reply(),
+	}
+	respMsg.Metadata.Set(message.MetadataError, envelope.Code.String())
+
+	data, e := reqMsg.Encoding.Marshal(envelope)
+	if e != nil {
+		// Bytes only encodings carry the envelope as JSON
+		raw, e := json.Marshal(envelope)
+		if e != nil {
+			return nil, err
+		}
+		data, e = reqMsg.Encoding.Marshal(raw)
+		if e != nil {
+			respMsg.Encoding = encoding.NewJSON()
+			data = raw
+		}
+	}
+	respMsg.Data = data
+	return respMsg, nil
+}
+
+// ErrorOf returns the *Error carried by an error response, or nil for a normal one.
+func ErrorOf(msg *message.Message) error {
+	if _, ok := msg.Metadata[message.MetadataError]; !ok {
+		return nil
+	}
+
+	e := &Error{}
+	if err := msg.Encoding.Unmarshal(msg.Data, e); err == nil {
+		return e
+	}
+	bytes := encoding.NewBytes()
+	if err := msg.Encoding.Unmarshal(msg.Data, bytes); err == nil {
+		if err = json.Unmarshal(bytes.Data, e); err == nil {
+			return e
+		}
+	}
+	return &Error{
+		Code:    CodeUnknown,
+		Message: msg.Metadata[message.MetadataError],
+	}
+}
@@ -0,0 +1,75 @@
+package device_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/acoderup/boost/device"
+	"github.com/acoderup/boost/encoding"
+	"github.com/acoderup/boost/message"
+	"github.com/acoderup/boost/route"
+	"github.com/acoderup/boost/style"
+)
+
+type Strict struct{}
+
+func (*Strict) Check(_ context.Context, req *Ping) (*Pong, error) {
+	if req.Text != "ok" {
+		return nil, device.NewError(device.CodeFailedPrecondition, "text is %q", req.Text).
+			WithDetail("field", "text").WithRetryable()
+	}
+	return &Pong{Text: req.Text}, nil
+}
+
+func (*Strict) Raw(context.Context, []byte) ([]byte, error) {
+	return nil, errors.New("raw failure")
+}
+
+func invokeStrict(t *testing.T, client *device.Client, path string, e encoding.Encoding, data []byte) (*message.Message, error) {
+	t.Helper()
+	var resp *message.Message
+	var err error
+	if e := client.Invoke(context.Background(), &message.Message{
+		Route:    route.NewChainRoute(device.Addr(client), style.GoogleChain(path)),
+		Encoding: e,
+		Data:     data,
+	}, device.WithFail(device.NewFuncProcessor(func(_ context.Context, msg *message.Message) error {
+		resp = msg
+		return nil
+	}), func(_ uint64, e error) {
+		err = e
+	})); e != nil {
+		t.Fatalf("unexpected error: %v", e)
+	}
+	return resp, err
+}
+
+func TestError(t *testing.T) {
+	client := device.NewClient("Anonymous")
+	device.NewBus().Integrate(client, device.NewRouter("Strict").Integrate(&Strict{}))
+
+	resp, err := invokeStrict(t, client, "/strict/check", e1, encoding.Encode(e1, &Ping{Text: "ok"}))
+	if err != nil || resp == nil || device.ErrorOf(resp) != nil {
+		t.Fatalf("unexpected response %v, error %v", resp, err)
+	}
+
+	_, err = invokeStrict(t, client, "/strict/check", e1, encoding.Encode(e1, &Ping{Text: "no"}))
+	var e *device.Error
+	if !errors.As(err, &e) {
+		t.Fatalf("expecting *device.Error, got %v", err)
+	}
+	if e.Code != device.CodeFailedPrecondition || e.Message != `text is "no"` || e.Details["field"] != "text" || !e.Retryable {
+		t.Fatalf("unexpected error %+v", e)
+	}
+
+	_, err = invokeStrict(t, client, "/strict/check", e1, []byte(`{"text":`))
+	if !errors.As(err, &e) || e.Code != device.CodeInvalidArgument {
+		t.Fatalf("expecting invalid argument, got %v", err)
+	}
+
+	_, err = invokeStrict(t, client, "/strict/raw", encoding.NewLazy(), []byte("raw"))
+	if !errors.As(err, &e) || e.Code != device.CodeUnknown || e.Message != "raw failure" {
+		t.Fatalf("expecting unknown error, got %v", err)
+	}
+}
@@ -0,0 +1,43 @@
+package device
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+var (
+	ErrFrameTooLarge = errors.New("frame exceeds the maximum size")
+)
+
+const (
+	frameHeaderSize = 4
+	frameMaxSize    = 64 << 20
+)
+
+func writeFrame(w io.Writer, payload []byte) error {
+	if len(payload) > frameMaxSize {
+		return ErrFrameTooLarge
+	}
+	frame := make([]byte, frameHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(frame, uint32(len(payload)))
+	copy(frame[frameHeaderSize:], payload)
+	_, err := w.Write(frame)
+	return err
+}
+
+func readFrame(r io.Reader) ([]byte, error) {
+	header := make([]byte, frameHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(header)
+	if size > frameMaxSize {
+		return nil, ErrFrameTooLarge
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
@@ -0,0 +1,192 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/acoderup/boost/message"
+	"github.com/acoderup/boost/route"
+)
+
+var (
+	ErrGatherNoMember = errors.New("gather cannot find any member in the group")
+	ErrGatherFailed   = errors.New("gather has failed on every member")
+)
+
+// Reducer folds a reply into the result accumulated so far, which is nil at first.
+type Reducer func(acc interface{}, reply *message.Message) (interface{}, error)
+
+// Collect keeps the replies as they are, the result is a []*message.Message.
+func Collect() Reducer {
+	return func(acc interface{}, reply *message.Message) (interface{}, error) {
+		replies, _ := acc.([]*message.Message)
+		return append(replies, reply), nil
+	}
+}
+
+// Fold decodes every reply into a *T and folds it into a result of type R.
+func Fold[T, R any](fold func(R, *T) R) Reducer {
+	return func(acc interface{}, reply *message.Message) (interface{}, error) {
+		v := new(T)
+		if err := reply.Encoding.Unmarshal(reply.Data, v); err != nil {
+			return acc, err
+		}
+		var r R
+		if acc != nil {
+			r = acc.(R)
+		}
+		return fold(r, v), nil
+	}
+}
+
+type GatherOption func(*GatherOptions)
+
+type GatherOptions struct {
+	Timeout time.Duration
+}
+
+var defaultGatherOptions = GatherOptions{
+	Timeout: 10 * time.Second,
+}
+
+// WithCallTimeout sets the timeout of the call to every member.
+func WithCallTimeout(timeout time.Duration) GatherOption {
+	return func(o *GatherOptions) {
+		o.Timeout = timeout
+	}
+}
+
+// GatherResult is the reduced replies of the members, and the failures of the others.
+type GatherResult struct {
+	Value    interface{}
+	Replies  int
+	Failures map[Device]error
+}
+
+type gathered struct {
+	member Device
+	reply  *message.Message
+	err    error
+}
+
+// Gather sends m to every member of the first group along its route which has more
+// than one device, such as every "Shard" router for "/shard/online-count", and reduces
+// the replies. The error is only returned when no member replies, partial failures
+// are reported in the result.
+func (c *Client) Gather(ctx context.Context, m *message.Message, reducer Reducer, opts ...GatherOption) (*GatherResult, error) {
+	options := defaultGatherOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	r, ok := m.Route.(addressed)
+	if !ok {
+		return nil, message.ErrCodecUnsupportedRoute
+	}
+	dst := r.Dst()
+	members, index := c.members(dst, m.Metadata)
+	if len(members) == 0 {
+		return nil, m.Route.Error(ErrGatherNoMember)
+	}
+
+	results := make(chan gathered, len(members))
+	src := Addr(c)
+	for _, member := range members {
+		go func(member Device) {
+			ctx, cancel := context.WithTimeout(ctx, options.Timeout)
+			defer cancel()
+
+			done := make(chan gathered, 1)
+			p := WithFail(NewFuncProcessor(func(_ context.Context, reply *message.Message) error {
+				if !Streaming(reply) {
+					done <- gathered{member: member, reply: reply, err: ErrorOf(reply)}
+				}
+				return nil
+			}), func(_ uint64, err error) {
+				done <- gathered{member: member, err: err}
+			})
+			msg := &message.Message{
+				Route:    route.MakeChainRoute(src, dst, index),
+				Encoding: m.Encoding,
+				Metadata: m.Metadata.Clone(),
+				Data:     m.Data,
+			}
+			if err := c.invoke(ctx, msg, p, member.Process); err != nil {
+				// A late reply fails to find the processor which has already failed
+				select {
+				case result := <-done:
+					results <- result
+				default:
+					results <- gathered{member: member, err: err}
+				}
+				return
+			}
+			select {
+			case result := <-done:
+				results <- result
+			case <-ctx.Done():
+				c.Cancel(msg.ID)
+				results <- gathered{member: member, err: ctx.Err()}
+			}
+		}(member)
+	}
+
+	result := &GatherResult{Failures: make(map[Device]error)}
+	var errs []error
+	for range members {
+		g := <-results
+		if g.err == nil {
+			var err error
+			if result.Value, err = reducer(result.Value, g.reply); err == nil {
+				result.Replies++
+				continue
+			}
+			g.err = err
+		}
+		result.Failures[g.member] = g.err
+		errs = append(errs, fmt.Errorf("%s: %w", strings.Join(Addr(g.member)[1:], "/"), g.err))
+	}
+	if result.Replies == 0 {
+		return result, fmt.Errorf("%w: %w", ErrGatherFailed, errors.Join(errs...))
+	}
+	return result, nil
+}
+
+type resolver interface {
+	group(name string, msg *message.Message) ([]Device, Balancer, error)
+}
+
+// members walks dst down from the root to the first group which has more than one
+// device, and returns the group with its index in dst. Groups are resolved as routing
+// does, by patterns and by the version md asks for.
+func (c *Client) members(dst []string, md message.Metadata) ([]Device, int) {
+	var d Device = c
+	for d.Gateway() != nil {
+		d = d.Gateway()
+	}
+
+	src := Addr(c)
+	var members []Device
+	for index := 1; index < len(dst); index++ {
+		r, ok := unwrap(d).(resolver)
+		if !ok {
+			members = groupOf(d, dst[index])
+		} else if group, _, err := r.group(dst[index], &message.Message{
+			Route:    route.MakeChainRoute(src, dst, index),
+			Metadata: md,
+		}); err == nil {
+			members = slices.Clone(group)
+		} else {
+			members = nil
+		}
+		if len(members) != 1 || index == len(dst)-1 {
+			return members, index
+		}
+		d = members[0]
+	}
+	return nil, 0
+}
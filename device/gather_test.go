@@ -0,0 +1,117 @@
+package device_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/acoderup/boost/device"
+	"github.com/acoderup/boost/encoding"
+	"github.com/acoderup/boost/message"
+	"github.com/acoderup/boost/route"
+	"github.com/acoderup/boost/style"
+)
+
+type Online struct {
+	Count int `json:"count"`
+}
+
+type Census struct {
+	online int
+	err    error
+	delay  time.Duration
+}
+
+func (c *Census) OnlineCount(context.Context, *Ping) (*Online, error) {
+	time.Sleep(c.delay)
+	return &Online{Count: c.online}, c.err
+}
+
+func gatherOnline(t *testing.T, client *device.Client, opts ...device.GatherOption) (*device.GatherResult, error) {
+	t.Helper()
+	return client.Gather(context.Background(), &message.Message{
+		Route:    route.NewChainRoute(device.Addr(client), style.GoogleChain("/census/online-count")),
+		Encoding: e1,
+		Data:     encoding.Encode(e1, &Ping{}),
+	}, device.Fold(func(total int, online *Online) int {
+		return total + online.Count
+	}), opts...)
+}
+
+func TestGather(t *testing.T) {
+	client := device.NewClient("Anonymous")
+	bus := device.NewBus().Integrate(client)
+	for index := 1; index <= 3; index++ {
+		bus.Integrate(device.NewRouter("Census").Integrate(&Census{online: index}))
+	}
+
+	result, err := gatherOnline(t, client)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Value != 6 || result.Replies != 3 || len(result.Failures) != 0 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+
+	bus.Integrate(device.NewRouter("Census").Integrate(&Census{err: errors.New("shard is down")}))
+	bus.Integrate(device.NewRouter("Census").Integrate(&Census{online: 100, delay: 200 * time.Millisecond}))
+	result, err = gatherOnline(t, client, device.WithCallTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Value != 6 || result.Replies != 3 || len(result.Failures) != 2 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	for member, err := range result.Failures {
+		var e *device.Error
+		if !errors.As(err, &e) && !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("unexpected failure of %v: %v", device.Addr(member), err)
+		}
+	}
+
+	empty := device.NewClient("Anonymous")
+	device.NewBus().Integrate(empty)
+	if _, err := gatherOnline(t, empty); !errors.Is(err, device.ErrGatherNoMember) {
+		t.Fatalf("expecting no member error, got %v", err)
+	}
+}
+
+func TestGatherResolve(t *testing.T) {
+	client := device.NewClient("Anonymous")
+	bus := device.NewBus().Integrate(client)
+	for index := 1; index <= 2; index++ {
+		bus.Version("1.0.0", device.NewRouter("Census").Integrate(&Census{online: index}))
+	}
+	bus.Version("2.0.0", device.NewRouter("Census").Integrate(&Census{online: 10}))
+
+	// Members are the version routing would pick, the latest by default
+	result, err := gatherOnline(t, client)
+	if err != nil || result.Value != 10 || result.Replies != 1 {
+		t.Fatalf("unexpected result %+v: %v", result, err)
+	}
+	result, err = client.Gather(context.Background(), &message.Message{
+		Route:    route.NewChainRoute(device.Addr(client), style.GoogleChain("/census/online-count")),
+		Encoding: e1,
+		Metadata: message.Metadata{message.MetadataVersion: "1.0.0"},
+		Data:     encoding.Encode(e1, &Ping{}),
+	}, device.Collect())
+	if err != nil || result.Replies != 2 {
+		t.Fatalf("unexpected result %+v: %v", result, err)
+	}
+
+	// Segments are matched by patterns the same way
+	world := device.NewRouter("World")
+	bus.Integrate(world)
+	for index := 1; index <= 2; index++ {
+		world.Integrate(device.NewRouter("{region}").Integrate(&Census{online: index}))
+	}
+	result, err = client.Gather(context.Background(), &message.Message{
+		Route:    route.NewChainRoute(device.Addr(client), style.GoogleChain("/world/eu/online-count")),
+		Encoding: e1,
+		Data:     encoding.Encode(e1, &Ping{}),
+	}, device.Collect())
+	if err != nil || result.Replies != 2 {
+		t.Fatalf("unexpected result %+v: %v", result, err)
+	}
+}
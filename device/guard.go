@@ -0,0 +1,121 @@
+package device
+
+import (
+	"context"
+
+	"github.com/acoderup/boost/message"
+)
+
+// Guard admits or rejects messages before they reach the devices it protects. Admitted
+// messages are released with the error of the device, including the error a handler
+// replies with.
+type Guard interface {
+	Admit(ctx context.Context, msg *message.Message) (release func(error), err error)
+}
+
+type guarded struct {
+	Device
+	guards []Guard
+}
+
+// Guarded puts guards in front of d, the guarded device takes the name of d and is
+// extended into routers in place of it, while d keeps the router as its gateway.
+func Guarded(d Device, guards ...Guard) Device {
+	if g, ok := d.(*guarded); ok {
+		return &guarded{
+			Device: g.Device,
+			guards: append(append([]Guard{}, g.guards...), guards...),
+		}
+	}
+	return &guarded{
+		Device: d,
+		guards: guards,
+	}
+}
+
+func (g *guarded) Key() string {
+	return deviceKey(g.Device)
+}
+
+// Unwrap returns the device being guarded.
+func (g *guarded) Unwrap() Device {
+	return g.Device
+}
+
+func (g *guarded) Process(ctx context.Context, msg *message.Message) error {
+	if !msg.Route.Dispatching() {
+		return g.Device.Process(ctx, msg)
+	}
+
+	ctx, outer := takeOutcome(ctx)
+	o := &outcome{discard: outer != nil && outer.discard}
+	defer func() {
+		if outer != nil {
+			*outer = *o
+		}
+	}()
+	releases := make([]func(error), 0, len(g.guards))
+	defer func() {
+		// Released in reverse order, as if every guard wraps the next one
+		for index := len(releases) - 1; index >= 0; index-- {
+			releases[index](o.err)
+		}
+	}()
+	for _, guard := range g.guards {
+		release, err := guard.Admit(ctx, msg)
+		if err != nil {
+			// Guards admitted so far are released with the rejection
+			o.err = err
+			return msg.Route.Error(err)
+		}
+		releases = append(releases, release)
+	}
+
+	err := g.Device.Process(context.WithValue(ctx, outcomeKey{}, o), msg)
+	if err != nil {
+		o.err = err
+	}
+	return err
+}
+
+// Guard puts guards in front of every device in the group called name, including the
+// devices extended later, the state of the guards is shared by the group.
+func (r *Router) Guard(name string, guards ...Guard) *Router {
+	r.rwMutex.Lock()
+	defer r.rwMutex.Unlock()
+
+	if r.guards == nil {
+		r.guards = make(map[string][]Guard)
+	}
+	r.guards[name] = append(r.guards[name], guards...)
+
+	devices := make([]Device, 0, len(r.devices[name]))
+	for _, device := range r.devices[name] {
+		devices = append(devices, Guarded(device, guards...))
+	}
+	if len(devices) > 0 {
+		r.devices[name] = devices
+	}
+	return r
+}
+
+type outcomeKey struct{}
+
+// outcome carries the error a handler replies with back to the guards and publishers,
+// handled tells it apart from the errors of routing. Discard drops the reply of the
+// handler, for messages nobody waits for.
+type outcome struct {
+	err     error
+	handled bool
+	discard bool
+}
+
+// takeOutcome returns the outcome of the innermost guard, and hides it from the rest of
+// the chain so nested calls do not report to it.
+func takeOutcome(ctx context.Context) (context.Context, *outcome) {
+	o, _ := ctx.Value(outcomeKey{}).(*outcome)
+	if o == nil {
+		return ctx, nil
+	}
+	return context.WithValue(ctx, outcomeKey{}, (*outcome)(nil)), o
+}
@@ -0,0 +1,183 @@
+package device_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/acoderup/boost/device"
+	"github.com/acoderup/boost/encoding"
+	"github.com/acoderup/boost/message"
+	"github.com/acoderup/boost/route"
+	"github.com/acoderup/boost/style"
+)
+
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+type Flaky struct {
+	fail bool
+}
+
+func (f *Flaky) Call(context.Context, *Ping) (*Pong, error) {
+	if f.fail {
+		return nil, errors.New("flaky")
+	}
+	return &Pong{}, nil
+}
+
+func invokeGuarded(t *testing.T, client *device.Client, user string) error {
+	t.Helper()
+	var err error
+	if e := client.Invoke(context.Background(), &message.Message{
+		Route:    route.NewChainRoute(device.Addr(client), style.GoogleChain("/flaky/call")),
+		Encoding: e1,
+		Metadata: message.Metadata{message.MetadataUserID: user},
+		Data:     encoding.Encode(e1, &Ping{}),
+	}, device.WithFail(device.NewFuncProcessor(func(context.Context, *message.Message) error {
+		return nil
+	}), func(_ uint64, e error) {
+		err = e
+	})); e != nil {
+		return e
+	}
+	return err
+}
+
+func newGuardedBus(flaky *Flaky, guards ...device.Guard) *device.Client {
+	client := device.NewClient("Anonymous")
+	router := device.NewRouter("Flaky").Integrate(flaky).Guard("Call", guards...)
+	device.NewBus().Integrate(client, router)
+	return client
+}
+
+func TestRateLimiter(t *testing.T) {
+	c := &clock{now: time.Unix(0, 0)}
+	limiter := device.NewRateLimiter(1, 2).Key(device.MetadataKey(message.MetadataUserID)).Clock(c.Now)
+	client := newGuardedBus(&Flaky{}, limiter)
+
+	for index := 0; index < 2; index++ {
+		if err := invokeGuarded(t, client, "alice"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := invokeGuarded(t, client, "alice"); !errors.Is(err, device.ErrRateLimited) {
+		t.Fatalf("expecting rate limited, got %v", err)
+	}
+	if err := invokeGuarded(t, client, "bob"); err != nil {
+		t.Fatalf("expecting a bucket per user, got %v", err)
+	}
+
+	c.now = c.now.Add(time.Second)
+	if err := invokeGuarded(t, client, "alice"); err != nil {
+		t.Fatalf("expecting refilled bucket, got %v", err)
+	}
+	if err := invokeGuarded(t, client, "alice"); !errors.Is(err, device.ErrRateLimited) {
+		t.Fatalf("expecting rate limited, got %v", err)
+	}
+}
+
+func TestConcurrencyLimiter(t *testing.T) {
+	limiter := device.NewConcurrencyLimiter(1)
+	release, err := limiter.Admit(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := limiter.Admit(context.Background(), nil); !errors.Is(err, device.ErrConcurrencyLimited) {
+		t.Fatalf("expecting concurrency limited, got %v", err)
+	}
+	release(nil)
+
+	client := newGuardedBus(&Flaky{}, limiter)
+	if err := invokeGuarded(t, client, ""); err != nil || limiter.Inflight() != 0 {
+		t.Fatalf("unexpected error %v with %d inflight", err, limiter.Inflight())
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	c := &clock{now: time.Unix(0, 0)}
+	breaker := device.NewCircuitBreaker(2, time.Minute).Clock(c.Now)
+	flaky := &Flaky{fail: true}
+	client := newGuardedBus(flaky, breaker)
+
+	var e *device.Error
+	for index := 0; index < 2; index++ {
+		if err := invokeGuarded(t, client, ""); !errors.As(err, &e) {
+			t.Fatalf("expecting handler error, got %v", err)
+		}
+	}
+	if err := invokeGuarded(t, client, ""); !errors.Is(err, device.ErrCircuitOpen) || breaker.State() != device.BreakerOpen {
+		t.Fatalf("expecting open circuit, got %v", err)
+	}
+
+	c.now = c.now.Add(time.Minute)
+	if state := breaker.State(); state != device.BreakerHalfOpen {
+		t.Fatalf("expecting half-open circuit, got %v", state)
+	}
+	if err := invokeGuarded(t, client, ""); !errors.As(err, &e) || breaker.State() != device.BreakerOpen {
+		t.Fatalf("expecting failed probe to open the circuit, got %v", err)
+	}
+
+	flaky.fail = false
+	c.now = c.now.Add(time.Minute)
+	if err := invokeGuarded(t, client, ""); err != nil || breaker.State() != device.BreakerClosed {
+		t.Fatalf("expecting successful probe to close the circuit, got %v", err)
+	}
+}
+
+type recorder struct {
+	released []error
+}
+
+func (r *recorder) Admit(context.Context, *message.Message) (func(error), error) {
+	return func(err error) {
+		r.released = append(r.released, err)
+	}, nil
+}
+
+type rejector struct{}
+
+var errRejected = errors.New("rejected")
+
+func (rejector) Admit(context.Context, *message.Message) (func(error), error) {
+	return nil, errRejected
+}
+
+func TestGuardRelease(t *testing.T) {
+	// Guards admitted before a rejection are released with it
+	r := &recorder{}
+	client := newGuardedBus(&Flaky{}, r, rejector{})
+	if err := invokeGuarded(t, client, ""); !errors.Is(err, errRejected) {
+		t.Fatalf("expecting rejected, got %v", err)
+	}
+	if len(r.released) != 1 || !errors.Is(r.released[0], errRejected) {
+		t.Fatalf("expecting release with the rejection, got %v", r.released)
+	}
+}
+
+func TestGuardLater(t *testing.T) {
+	// Devices joining a guarded group are guarded too
+	r := &recorder{}
+	client := device.NewClient("Anonymous")
+	router := device.NewRouter("Flaky").Guard("Call", r).Integrate(&Flaky{})
+	device.NewBus().Integrate(client, router)
+	if err := invokeGuarded(t, client, ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(r.released) != 1 || r.released[0] != nil {
+		t.Fatalf("expecting the later device to be guarded, got %v", r.released)
+	}
+
+	// Shrinking the device finds it behind its guards
+	flaky := router.Members("Call")[0]
+	router.Shrink(flaky.(interface{ Unwrap() device.Device }).Unwrap())
+	if n := len(router.Members("Call")); n != 0 {
+		t.Fatalf("expecting the guarded device to be shrunk, got %d", n)
+	}
+}
@@ -2,21 +2,113 @@ package device
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"reflect"
+	"slices"
 
 	"github.com/acoderup/boost/encoding"
 	"github.com/acoderup/boost/magic"
 	"github.com/acoderup/boost/message"
 )
 
+var (
+	ErrHandlerInvalidRequest = errors.New("handler cannot decode request")
+)
+
+type handlerMode int
+
+const (
+	// modeUnary replies once: func(ctx, *Req) (*Resp, error)
+	modeUnary handlerMode = iota
+	// modeOneWay never replies: func(ctx, *Req) error
+	modeOneWay
+	// modeStream replies through a callback: func(ctx, *Req, func(*Resp) error) error
+	modeStream
+	// modeChannel replies with what it receives: func(ctx, *Req) (<-chan *Resp, error)
+	modeChannel
+)
+
+var handlerModeName = map[handlerMode]string{
+	modeUnary:   "unary",
+	modeOneWay:  "one-way",
+	modeStream:  "stream",
+	modeChannel: "channel",
+}
+
 type Handler struct {
 	*Base
-	receiver reflect.Value
-	method   reflect.Method
+	name         string
+	call         func(context.Context, *message.Message) (*message.Message, error)
+	fn           reflect.Type
+	receiver     reflect.Value
+	method       reflect.Method
+	mode         handlerMode
+	version      string
+	interceptors []Interceptor
+	override     bool
 }
 
 func (h *Handler) String() string {
-	return h.method.Name
+	return h.name
+}
+
+// Signature returns the signature of the handler function, without the receiver.
+func (h *Handler) Signature() string {
+	if h.fn == nil {
+		return ""
+	}
+	return h.fn.String()
+}
+
+// Types returns the request and response types, the response type is nil for one-way
+// handlers, and is the type of every response for streaming handlers.
+func (h *Handler) Types() (req, resp reflect.Type) {
+	if h.fn == nil {
+		return nil, nil
+	}
+	req = h.fn.In(1)
+	switch h.mode {
+	case modeUnary:
+		resp = h.fn.Out(0)
+	case modeStream:
+		resp = h.fn.In(2).In(0)
+	case modeChannel:
+		resp = h.fn.Out(0).Elem()
+	}
+	return req, resp
+}
+
+// Mode returns how the handler replies: unary, one-way, stream or channel.
+func (h *Handler) Mode() string {
+	return handlerModeName[h.mode]
+}
+
+// Version returns the version the handler serves, empty unless integrated with
+// Router.Version.
+func (h *Handler) Version() string {
+	return h.version
+}
+
+// Use overrides the interceptors inherited from routers with its own chain.
+func (h *Handler) Use(interceptors ...Interceptor) *Handler {
+	h.interceptors = interceptors
+	h.override = true
+	return h
+}
+
+// Interceptors returns the effective chain, from the outermost router to the handler.
+func (h *Handler) Interceptors() []Interceptor {
+	if h.override {
+		return h.interceptors
+	}
+	var interceptors []Interceptor
+	for d := h.gateway; d != nil; d = d.Gateway() {
+		if r, ok := unwrap(d).(*Router); ok {
+			interceptors = slices.Concat(r.chain(), interceptors)
+		}
+	}
+	return interceptors
 }
 
 func (h *Handler) Process(ctx context.Context, msg *message.Message) error {
@@ -30,15 +122,32 @@ func (h *Handler) Process(ctx context.Context, msg *message.Message) error {
 }
 
 func (h *Handler) localProcess(ctx context.Context, reqMsg *message.Message) error {
-	if h.method.Type == magic.TypeNil {
+	if h.call == nil {
 		return nil
 	}
 
-	respMsg, err := h.do(ctx, reqMsg)
-	if err != nil {
+	ctx, o := takeOutcome(ctx)
+	ctx, end := observe(ctx, h, reqMsg)
+	var respMsg *message.Message
+	err := intercept(h.Interceptors(), ctx, reqMsg, func(ctx context.Context, reqMsg *message.Message) (err error) {
+		respMsg, err = h.do(ctx, reqMsg)
 		return err
+	})
+	end(err)
+	if o != nil {
+		o.err, o.handled = err, true
+	}
+	if err != nil {
+		if h.mode == modeOneWay {
+			return err
+		}
+		// Errors travel back to the caller as responses, so remote callers see them too
+		respMsg, err = errorMessage(reqMsg, err)
+		if err != nil {
+			return err
+		}
 	}
-	if respMsg != nil {
+	if respMsg != nil && (o == nil || !o.discard) {
 		return h.Process(ctx, respMsg)
 	}
 
@@ -47,37 +156,91 @@ func (h *Handler) localProcess(ctx context.Context, reqMsg *message.Message) err
 
 func (h *Handler) do(ctx context.Context, reqMsg *message.Message) (*message.Message, error) {
 	ctx = context.WithValue(ctx, ContextRequest, reqMsg)
+	ctx = context.WithValue(ctx, ContextMetadata, reqMsg.Metadata)
+	if p, ok := reqMsg.Route.(interface{ Params() map[string]string }); ok {
+		ctx = context.WithValue(ctx, ContextParams, p.Params())
+	}
+	return h.call(ctx, reqMsg)
+}
 
+func (h *Handler) reflectCall(ctx context.Context, reqMsg *message.Message) (*message.Message, error) {
 	mt := h.method.Type
 	var req interface{}
 	if mt.In(2) == magic.TypeOfBytes {
-		bytes := &encoding.Bytes{}
-		err := reqMsg.Encoding.Unmarshal(reqMsg.Data, bytes)
-		if err != nil {
+		var bytes []byte
+		if err := decode(reqMsg, &bytes); err != nil {
 			return nil, err
 		}
-		req = bytes.Data
+		req = bytes
 	} else {
 		req = reflect.New(mt.In(2).Elem()).Interface()
-		err := reqMsg.Encoding.Unmarshal(reqMsg.Data, req)
-		if err != nil {
+		if err := decode(reqMsg, req); err != nil {
 			return nil, err
 		}
 	}
 
 	in := []reflect.Value{h.receiver, reflect.ValueOf(ctx), reflect.ValueOf(req)}
 
+	switch h.mode {
+	case modeOneWay:
+		out := h.method.Func.Call(in)
+		if e := out[0].Interface(); e != nil {
+			return nil, e.(error)
+		}
+		return nil, nil
+	case modeStream:
+		s := &stream{handler: h, reqMsg: reqMsg}
+		send := reflect.MakeFunc(mt.In(3), func(args []reflect.Value) []reflect.Value {
+			err := s.send(ctx, args[0].Interface())
+			return []reflect.Value{reflect.ValueOf(&err).Elem()}
+		})
+		out := h.method.Func.Call(append(in, send))
+		if e := out[0].Interface(); e != nil {
+			return nil, e.(error)
+		}
+		return reply(reqMsg, nil)
+	case modeChannel:
+		out := h.method.Func.Call(in)
+		if e := out[1].Interface(); e != nil {
+			return nil, e.(error)
+		}
+		s := &stream{handler: h, reqMsg: reqMsg}
+		if err := s.drain(ctx, out[0]); err != nil {
+			return nil, err
+		}
+		return reply(reqMsg, nil)
+	}
+
 	out := h.method.Func.Call(in)
 	if e := out[1].Interface(); e != nil {
 		return nil, e.(error)
 	}
+	return reply(reqMsg, out[0].Interface())
+}
 
-	resp := out[0].Interface()
+// decode decodes the request into v, a *[]byte takes the bytes whatever the encoding is.
+func decode(reqMsg *message.Message, v interface{}) error {
+	var err error
+	if b, ok := v.(*[]byte); ok {
+		bytes := &encoding.Bytes{}
+		if err = reqMsg.Encoding.Unmarshal(reqMsg.Data, bytes); err == nil {
+			*b = bytes.Data
+		}
+	} else {
+		err = reqMsg.Encoding.Unmarshal(reqMsg.Data, v)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrHandlerInvalidRequest, err)
+	}
+	return nil
+}
 
+func reply(reqMsg *message.Message, resp interface{}) (*message.Message, error) {
 	respMsg := &message.Message{
 		ID:       reqMsg.ID,
 		Route:    reqMsg.Route.Reverse(),
 		Encoding: reqMsg.Encoding.Reverse(),
+		Metadata: reqMsg.Metadata.Reply(),
 	}
 	if resp != nil {
 		respData, err := reqMsg.Encoding.Marshal(resp)
@@ -107,27 +270,66 @@ func extractHandlers(c interface{}) []Device {
 		switch {
 		case mt.PkgPath() != "": // Check method is exported
 			continue
-		case mt.NumIn() != 3: // Check num in
-			continue
-		case mt.NumOut() != 2: // Check num in
+		case mt.NumIn() < 3: // Check num in
 			continue
 		case !mt.In(1).Implements(magic.TypeOfContext): // Check context.Context
 			continue
-		case !mt.Out(1).Implements(magic.TypeOfError): // Check error
+		case !mt.Out(mt.NumOut() - 1).Implements(magic.TypeOfError): // Check error
 			continue
-		case mt.In(2).Kind() != reflect.Ptr && mt.In(2) != magic.TypeOfBytes: // Check request:  pointer or bytes
+		case !isPayload(mt.In(2)): // Check request:  pointer or bytes
 			continue
-		case mt.Out(0).Kind() != reflect.Ptr && mt.Out(0) != magic.TypeOfBytes: // Check response: pointer or bytes
+		}
+
+		mode, ok := handlerModeOf(mt)
+		if !ok {
 			continue
 		}
 
 		receiver := reflect.ValueOf(c)
+		in := make([]reflect.Type, 0, mt.NumIn()-1)
+		for i := 1; i < mt.NumIn(); i++ {
+			in = append(in, mt.In(i))
+		}
+		out := make([]reflect.Type, 0, mt.NumOut())
+		for i := 0; i < mt.NumOut(); i++ {
+			out = append(out, mt.Out(i))
+		}
+
 		handler := &Handler{
 			Base:     NewBase(),
+			name:     method.Name,
+			fn:       reflect.FuncOf(in, out, false),
 			receiver: receiver,
 			method:   method,
+			mode:     mode,
 		}
+		handler.call = handler.reflectCall
 		devices = append(devices, handler)
 	}
 	return devices
 }
+
+func handlerModeOf(mt reflect.Type) (handlerMode, bool) {
+	// Every handler reports its failure by the last result
+	if mt.NumOut() == 0 || mt.Out(mt.NumOut()-1) != magic.TypeOfError {
+		return modeUnary, false
+	}
+	switch {
+	case mt.NumIn() == 3 && mt.NumOut() == 2 && isPayload(mt.Out(0)):
+		return modeUnary, true
+	case mt.NumIn() == 3 && mt.NumOut() == 1:
+		return modeOneWay, true
+	case mt.NumIn() == 3 && mt.NumOut() == 2 && mt.Out(0).Kind() == reflect.Chan &&
+		mt.Out(0).ChanDir()&reflect.RecvDir != 0 && isPayload(mt.Out(0).Elem()):
+		return modeChannel, true
+	case mt.NumIn() == 4 && mt.NumOut() == 1 && mt.In(3).Kind() == reflect.Func &&
+		mt.In(3).NumIn() == 1 && isPayload(mt.In(3).In(0)) &&
+		mt.In(3).NumOut() == 1 && mt.In(3).Out(0) == magic.TypeOfError:
+		return modeStream, true
+	}
+	return modeUnary, false
+}
+
+func isPayload(t reflect.Type) bool {
+	return t.Kind() == reflect.Ptr || t == magic.TypeOfBytes
+}
@@ -0,0 +1,74 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"log"
+	"runtime/debug"
+	"time"
+
+	"github.com/acoderup/boost/message"
+)
+
+var (
+	ErrHandlerPanic = errors.New("handler panics")
+)
+
+type Invoker func(context.Context, *message.Message) error
+
+// Interceptor wraps handler dispatch, it decides whether and how to call next.
+type Interceptor func(ctx context.Context, msg *message.Message, next Invoker) error
+
+func Chain(interceptors ...Interceptor) Interceptor {
+	return func(ctx context.Context, msg *message.Message, next Invoker) error {
+		return intercept(interceptors, ctx, msg, next)
+	}
+}
+
+func intercept(interceptors []Interceptor, ctx context.Context, msg *message.Message, invoker Invoker) error {
+	if len(interceptors) == 0 {
+		return invoker(ctx, msg)
+	}
+	return interceptors[0](ctx, msg, func(ctx context.Context, msg *message.Message) error {
+		return intercept(interceptors[1:], ctx, msg, invoker)
+	})
+}
+
+// Recovery turns a panic in the rest of the chain into ErrHandlerPanic, the panic and
+// its stack are logged by the standard logger rather than sent to the caller.
+func Recovery() Interceptor {
+	return func(ctx context.Context, msg *message.Message, next Invoker) (err error) {
+		defer func() {
+			if v := recover(); v != nil {
+				log.Printf("request %d %v panic: %v\n%s", msg.ID, msg.Route, v, debug.Stack())
+				err = ErrHandlerPanic
+			}
+		}()
+		return next(ctx, msg)
+	}
+}
+
+// Timing reports how long the rest of the chain takes.
+func Timing(report func(context.Context, *message.Message, time.Duration, error)) Interceptor {
+	return func(ctx context.Context, msg *message.Message, next Invoker) error {
+		start := time.Now()
+		err := next(ctx, msg)
+		report(ctx, msg, time.Since(start), err)
+		return err
+	}
+}
+
+// Logging logs every request with its route, duration and error, the standard
+// logger is used when logger is nil.
+func Logging(logger *log.Logger) Interceptor {
+	if logger == nil {
+		logger = log.Default()
+	}
+	return Timing(func(_ context.Context, msg *message.Message, d time.Duration, err error) {
+		if err != nil {
+			logger.Printf("request %d %v %v error: %v", msg.ID, msg.Route, d, err)
+			return
+		}
+		logger.Printf("request %d %v %v", msg.ID, msg.Route, d)
+	})
+}
@@ -0,0 +1,114 @@
+package device_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/acoderup/boost/device"
+	"github.com/acoderup/boost/encoding"
+	"github.com/acoderup/boost/message"
+	"github.com/acoderup/boost/route"
+	"github.com/acoderup/boost/style"
+)
+
+type Panic struct{}
+
+func (*Panic) Boom(context.Context, *Ping) (*Pong, error) {
+	panic("boom")
+}
+
+func (*Panic) Quiet(_ context.Context, req *Ping) (*Pong, error) {
+	return &Pong{Text: req.Text}, nil
+}
+
+func record(trace *[]string, name string) device.Interceptor {
+	return func(ctx context.Context, msg *message.Message, next device.Invoker) error {
+		*trace = append(*trace, name+">")
+		err := next(ctx, msg)
+		*trace = append(*trace, "<"+name)
+		return err
+	}
+}
+
+// invokeLocal returns the error replied by the handler, handlers on the bus reply synchronously.
+func invokeLocal(t *testing.T, client *device.Client, path string) (err error) {
+	t.Helper()
+	if e := client.Invoke(context.Background(), &message.Message{
+		Route:    route.NewChainRoute(device.Addr(client), style.GoogleChain(path)),
+		Encoding: e1,
+		Data:     encoding.Encode(e1, &Ping{Text: "hi"}),
+	}, device.WithFail(device.NewFuncProcessor(func(context.Context, *message.Message) error {
+		return nil
+	}), func(_ uint64, e error) {
+		err = e
+	})); e != nil {
+		t.Fatalf("unexpected error: %v", e)
+	}
+	return err
+}
+
+func TestInterceptor(t *testing.T) {
+	var trace []string
+	client := device.NewClient("Anonymous")
+	service := device.NewRouter("Panic").Integrate(&Panic{}).Use(record(&trace, "inner"), device.Recovery())
+	router := device.NewRouter("1.0.0").Integrate(service).Use(record(&trace, "outer"))
+	device.NewBus().Integrate(client, router)
+
+	if err := invokeLocal(t, client, "/1.0.0/panic/quiet"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := strings.Join(trace, " "); got != "outer> inner> <inner <outer" {
+		t.Fatalf("unexpected trace %q", got)
+	}
+
+	// The stack of the panic stays in the log of the server
+	err := invokeLocal(t, client, "/1.0.0/panic/boom")
+	if e := device.AsError(err); e.Code != device.CodeInternal || e.Message != device.ErrHandlerPanic.Error() {
+		t.Fatalf("expecting recovered panic, got %v", err)
+	}
+
+	trace = nil
+	var elapsed time.Duration
+	service.Override("Quiet", device.Timing(func(_ context.Context, _ *message.Message, d time.Duration, _ error) {
+		elapsed = d
+	}))
+	if err := invokeLocal(t, client, "/1.0.0/panic/quiet"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(trace) != 0 || elapsed == 0 {
+		t.Fatalf("expecting overridden chain, got trace %v elapsed %v", trace, elapsed)
+	}
+}
+
+func TestInterceptorShortCircuit(t *testing.T) {
+	errDenied := errors.New("denied")
+	client := device.NewClient("Anonymous")
+	service := device.NewRouter("Panic").Integrate(&Panic{}).Use(
+		func(context.Context, *message.Message, device.Invoker) error {
+			return errDenied
+		})
+	device.NewBus().Integrate(client, service)
+
+	var e *device.Error
+	if err := invokeLocal(t, client, "/panic/boom"); !errors.As(err, &e) || e.Message != errDenied.Error() {
+		t.Fatalf("expecting denied error, got %v", err)
+	}
+}
+
+func TestInterceptorOverrideGuarded(t *testing.T) {
+	var trace []string
+	client := device.NewClient("Anonymous")
+	service := device.NewRouter("Panic").Integrate(&Panic{}).Guard("Quiet", device.NewConcurrencyLimiter(1))
+	device.NewBus().Integrate(client, service)
+
+	service.Override("Quiet", record(&trace, "override"))
+	if err := invokeLocal(t, client, "/panic/quiet"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := strings.Join(trace, " "); got != "override> <override" {
+		t.Fatalf("unexpected trace %q", got)
+	}
+}
@@ -0,0 +1,130 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/acoderup/boost/message"
+	"github.com/acoderup/boost/timex"
+)
+
+var (
+	ErrRateLimited        = errors.New("rate limit is exceeded")
+	ErrConcurrencyLimited = errors.New("concurrency limit is exceeded")
+)
+
+const rateLimiterSweepSize = 1024
+
+// RateLimiter is a token bucket Guard, refilled at rate tokens per second up to burst.
+// There is one bucket for every key, or a single one when no key is set.
+type RateLimiter struct {
+	rate    float64
+	burst   float64
+	key     KeyFunc
+	now     func() time.Time
+	mutex   sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+var _ Guard = (*RateLimiter)(nil)
+
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	return &RateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		now:     timex.Now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Key sets how messages are put in buckets, such as MetadataKey(message.MetadataUserID).
+func (l *RateLimiter) Key(key KeyFunc) *RateLimiter {
+	l.key = key
+	return l
+}
+
+// Clock sets where the time is read from, timex.Now by default.
+func (l *RateLimiter) Clock(now func() time.Time) *RateLimiter {
+	l.now = now
+	return l
+}
+
+func (l *RateLimiter) Admit(ctx context.Context, msg *message.Message) (func(error), error) {
+	var key string
+	if l.key != nil {
+		key = l.key(ctx, msg)
+	}
+	now := l.now()
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if len(l.buckets) >= rateLimiterSweepSize {
+		l.sweep(now)
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	l.refill(b, now)
+	if b.tokens < 1 {
+		return nil, ErrRateLimited
+	}
+	b.tokens--
+	return func(error) {}, nil
+}
+
+func (l *RateLimiter) refill(b *bucket, now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(l.burst, b.tokens+elapsed.Seconds()*l.rate)
+		b.last = now
+	}
+}
+
+// sweep drops the buckets which are full again, they are the same as new ones.
+func (l *RateLimiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		l.refill(b, now)
+		if b.tokens >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// ConcurrencyLimiter is a Guard letting at most n messages be processed at a time.
+type ConcurrencyLimiter struct {
+	slots chan struct{}
+}
+
+var _ Guard = (*ConcurrencyLimiter)(nil)
+
+func NewConcurrencyLimiter(n int) *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{
+		slots: make(chan struct{}, n),
+	}
+}
+
+func (l *ConcurrencyLimiter) Admit(context.Context, *message.Message) (func(error), error) {
+	select {
+	case l.slots <- struct{}{}:
+		return func(error) {
+			<-l.slots
+		}, nil
+	default:
+		return nil, ErrConcurrencyLimited
+	}
+}
+
+// Inflight returns the number of messages being processed.
+func (l *ConcurrencyLimiter) Inflight() int {
+	return len(l.slots)
+}
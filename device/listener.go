@@ -0,0 +1,185 @@
+package device
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"unicode"
+
+	"github.com/acoderup/boost/message"
+	"github.com/acoderup/boost/safe"
+)
+
+var (
+	ErrListenerClosed     = errors.New("listener is closed")
+	ErrHandshakeInvalid   = errors.New("handshake carries an invalid peer name")
+	ErrHandshakeDuplicate = errors.New("handshake carries the name of another device")
+)
+
+type shrinker interface {
+	Shrink(Device)
+}
+
+// validPeerName reports whether a peer may be called name, it must be a plain device
+// name which cannot be mistaken for a path or a pattern.
+func validPeerName(name string) bool {
+	if name == "" || len(name) > 255 {
+		return false
+	}
+	for _, r := range name {
+		switch {
+		case r == '/' || r == '{' || r == '}' || r == '*':
+			return false
+		case !unicode.IsPrint(r) || unicode.IsSpace(r):
+			return false
+		}
+	}
+	return true
+}
+
+// Listener is the accepting side of a process spanning connection. Every accepted
+// connection announces its peer name, and is extended into the gateway as a Conn
+// device under that name, so responses routed back to the peer leave through it. A
+// peer reconnecting under its name replaces its previous connection, while a name
+// taken by any other device is rejected.
+type Listener struct {
+	*Base
+	name     string
+	listener net.Listener
+	conns    sync.Map
+	joining  sync.Mutex
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+func NewListener(name string, listener net.Listener) *Listener {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Listener{
+		Base:     NewBase(),
+		name:     name,
+		listener: listener,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+func Listen(name, network, address string) (*Listener, error) {
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return NewListener(name, listener), nil
+}
+
+func (l *Listener) String() string {
+	return l.name
+}
+
+func (l *Listener) Addr() net.Addr {
+	return l.listener.Addr()
+}
+
+// Serve accepts connections until the listener is closed.
+func (l *Listener) Serve() error {
+	for {
+		conn, err := l.listener.Accept()
+		if err != nil {
+			select {
+			case <-l.ctx.Done():
+				return ErrListenerClosed
+			default:
+				return err
+			}
+		}
+		go safe.Default().Do(func() error {
+			return l.ServeConn(conn)
+		})
+	}
+}
+
+// ServeConn serves a single connection until it is closed, it is also useful with net.Pipe.
+func (l *Listener) ServeConn(conn net.Conn) error {
+	reader := bufio.NewReader(conn)
+	hello, err := readFrame(reader)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	if !validPeerName(string(hello)) {
+		conn.Close()
+		return ErrHandshakeInvalid
+	}
+
+	c := NewConn(string(hello), &bufferedConn{Conn: conn, reader: reader})
+	gateway := l.Gateway()
+	if gateway == nil {
+		c.Close()
+		return ErrGatewayNotFound
+	}
+	if err := l.join(gateway, c); err != nil {
+		c.Close()
+		return err
+	}
+	defer func() {
+		l.conns.Delete(c)
+		if s, ok := gateway.(shrinker); ok {
+			s.Shrink(c)
+		}
+	}()
+
+	return c.Serve(l.ctx)
+}
+
+// join extends c into gateway, closing the previous connection of the same peer.
+func (l *Listener) join(gateway Device, c *Conn) error {
+	l.joining.Lock()
+	defer l.joining.Unlock()
+
+	members := groupOf(gateway, c.String())
+	for _, member := range members {
+		if _, ok := l.conns.Load(member); !ok {
+			return ErrHandshakeDuplicate
+		}
+	}
+	for _, member := range members {
+		// Shrunk at once, so the peer is never reached through both connections
+		l.conns.Delete(member)
+		if s, ok := gateway.(shrinker); ok {
+			s.Shrink(member)
+		}
+		member.(*Conn).Close()
+	}
+
+	gateway.Extend(c)
+	c.Join(gateway)
+	l.conns.Store(c, struct{}{})
+	return nil
+}
+
+func (l *Listener) Process(_ context.Context, msg *message.Message) error {
+	return msg.Route.Error(ErrRouteDeadEnd)
+}
+
+func (l *Listener) Close() error {
+	l.cancel()
+	var err error
+	if l.listener != nil {
+		err = l.listener.Close()
+	}
+	l.conns.Range(func(key, _ any) bool {
+		key.(*Conn).Close()
+		return true
+	})
+	return err
+}
+
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (bc *bufferedConn) Read(b []byte) (int, error) {
+	return bc.reader.Read(b)
+}
@@ -0,0 +1,172 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/acoderup/boost/message"
+)
+
+var (
+	ErrMailboxFull = errors.New("mailbox is full")
+)
+
+type MailboxOption func(*MailboxOptions)
+
+type MailboxOptions struct {
+	Capacity    int
+	IdleTimeout time.Duration
+}
+
+var defaultMailboxOptions = MailboxOptions{
+	Capacity:    64,
+	IdleTimeout: time.Minute,
+}
+
+// WithMailboxCapacity sets how many messages may wait in a mailbox.
+func WithMailboxCapacity(capacity int) MailboxOption {
+	return func(o *MailboxOptions) {
+		o.Capacity = capacity
+	}
+}
+
+// WithMailboxIdleTimeout sets how long an empty mailbox is kept before it is evicted.
+func WithMailboxIdleTimeout(timeout time.Duration) MailboxOption {
+	return func(o *MailboxOptions) {
+		o.IdleTimeout = timeout
+	}
+}
+
+// Mailboxes serializes handler execution per entity. Messages are put in the mailbox
+// of their key and run one at a time in order, a full mailbox rejects messages with
+// ErrMailboxFull. Use Intercept on a router or handler group to opt in:
+//
+//	router.Use(device.NewMailboxes(device.MetadataKey("room-id")).Intercept)
+//
+// A handler must not wait for another message with its own key, which would never run.
+// A message whose context ends while it waits is dropped, while one already running is
+// waited for, since the handler still owns the request and its reply.
+type Mailboxes struct {
+	MailboxOptions
+	key   KeyFunc
+	mutex sync.Mutex
+	boxes map[string]*mailbox
+}
+
+type mailbox struct {
+	queue chan *letter
+}
+
+type letter struct {
+	ctx   context.Context
+	msg   *message.Message
+	next  Invoker
+	done  chan error
+	state int32
+}
+
+const (
+	letterQueued int32 = iota
+	letterRunning
+	letterAbandoned
+)
+
+func NewMailboxes(key KeyFunc, opts ...MailboxOption) *Mailboxes {
+	m := &Mailboxes{
+		MailboxOptions: defaultMailboxOptions,
+		key:            key,
+		boxes:          make(map[string]*mailbox),
+	}
+	for _, opt := range opts {
+		opt(&m.MailboxOptions)
+	}
+	return m
+}
+
+// Intercept is the Interceptor putting messages in their mailboxes, messages without
+// a key belong to no entity and are processed directly.
+func (m *Mailboxes) Intercept(ctx context.Context, msg *message.Message, next Invoker) error {
+	key := m.key(ctx, msg)
+	if key == "" {
+		return next(ctx, msg)
+	}
+
+	l := &letter{
+		ctx:  ctx,
+		msg:  msg,
+		next: next,
+		done: make(chan error, 1),
+	}
+	if err := m.post(key, l); err != nil {
+		return err
+	}
+
+	select {
+	case err := <-l.done:
+		return err
+	case <-ctx.Done():
+		if atomic.CompareAndSwapInt32(&l.state, letterQueued, letterAbandoned) {
+			return ctx.Err()
+		}
+		return <-l.done
+	}
+}
+
+// Len returns the number of mailboxes which have not been evicted.
+func (m *Mailboxes) Len() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return len(m.boxes)
+}
+
+func (m *Mailboxes) post(key string, l *letter) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	box, ok := m.boxes[key]
+	if !ok {
+		box = &mailbox{queue: make(chan *letter, m.Capacity)}
+		m.boxes[key] = box
+		go m.run(key, box)
+	}
+	select {
+	case box.queue <- l:
+		return nil
+	default:
+		return ErrMailboxFull
+	}
+}
+
+func (m *Mailboxes) run(key string, box *mailbox) {
+	timer := time.NewTimer(m.IdleTimeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case l := <-box.queue:
+			switch {
+			case !atomic.CompareAndSwapInt32(&l.state, letterQueued, letterRunning):
+				// Abandoned by its caller, nothing waits for it
+			case l.ctx.Err() != nil:
+				l.done <- l.ctx.Err()
+			default:
+				l.done <- Recovery()(l.ctx, l.msg, l.next)
+			}
+			timer.Reset(m.IdleTimeout)
+		case <-timer.C:
+			// Posting holds the mutex, so nothing can arrive while evicting.
+			m.mutex.Lock()
+			if len(box.queue) == 0 {
+				delete(m.boxes, key)
+				m.mutex.Unlock()
+				return
+			}
+			m.mutex.Unlock()
+			timer.Reset(m.IdleTimeout)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package device_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/acoderup/boost/device"
+	"github.com/acoderup/boost/encoding"
+	"github.com/acoderup/boost/message"
+	"github.com/acoderup/boost/route"
+	"github.com/acoderup/boost/style"
+)
+
+type Game struct {
+	moves map[string]*[]int
+}
+
+type Move struct {
+	Room string
+	Step int
+}
+
+func (g *Game) Play(_ context.Context, req *Move) (*Pong, error) {
+	moves := g.moves[req.Room]
+	*moves = append(*moves, req.Step)
+	return &Pong{}, nil
+}
+
+func TestMailboxes(t *testing.T) {
+	game := &Game{moves: map[string]*[]int{"a": {}, "b": {}}}
+	client := device.NewClient("Anonymous")
+	router := device.NewRouter("Game").Integrate(game).Use(device.NewMailboxes(device.RequestKey("Room")).Intercept)
+	device.NewBus().Integrate(client, router)
+
+	var wg sync.WaitGroup
+	for _, room := range []string{"a", "b"} {
+		wg.Add(1)
+		go func(room string) {
+			defer wg.Done()
+			for step := 0; step < 100; step++ {
+				err := client.Invoke(context.Background(), &message.Message{
+					Route:    route.NewChainRoute(device.Addr(client), style.GoogleChain("/game/play")),
+					Encoding: e1,
+					Data:     encoding.Encode(e1, &Move{Room: room, Step: step}),
+				}, device.NewFuncProcessor(func(context.Context, *message.Message) error {
+					return nil
+				}))
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+			}
+		}(room)
+	}
+	wg.Wait()
+
+	for room, moves := range game.moves {
+		for step, move := range *moves {
+			if move != step {
+				t.Fatalf("expecting moves of room %s in order, got %v", room, *moves)
+			}
+		}
+	}
+}
+
+func TestMailboxesBackpressure(t *testing.T) {
+	boxes := device.NewMailboxes(device.MetadataKey("room-id"),
+		device.WithMailboxCapacity(1), device.WithMailboxIdleTimeout(20*time.Millisecond))
+	msg := &message.Message{Metadata: message.Metadata{"room-id": "a"}}
+
+	started, release := make(chan struct{}), make(chan struct{})
+	busy := make(chan error, 1)
+	go func() {
+		busy <- boxes.Intercept(context.Background(), msg, func(context.Context, *message.Message) error {
+			close(started)
+			<-release
+			return nil
+		})
+	}()
+	<-started
+
+	// The canceled message stays in the mailbox until the worker skips it
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	skipped := func(context.Context, *message.Message) error {
+		t.Error("unexpected run of a canceled message")
+		return nil
+	}
+	if err := boxes.Intercept(ctx, msg, skipped); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expecting canceled error, got %v", err)
+	}
+	err := boxes.Intercept(context.Background(), msg, skipped)
+	if e := device.AsError(err); !errors.Is(err, device.ErrMailboxFull) || e.Code != device.CodeResourceExhausted || !e.Retryable {
+		t.Fatalf("expecting retryable full mailbox, got %v", err)
+	}
+
+	close(release)
+	if err := <-busy; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if n := boxes.Len(); n != 1 {
+		t.Fatalf("expecting 1 mailbox, got %d", n)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for boxes.Len() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout when waiting for %d mailboxes to be evicted", boxes.Len())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+type Slow struct {
+	started, release chan struct{}
+}
+
+func (s *Slow) Play(context.Context, *Move) (*Pong, error) {
+	close(s.started)
+	<-s.release
+	return &Pong{Text: "late"}, nil
+}
+
+func TestMailboxesCancelRunning(t *testing.T) {
+	slow := &Slow{started: make(chan struct{}), release: make(chan struct{})}
+	client := device.NewClient("Anonymous")
+	router := device.NewRouter("Game").Integrate(slow).Use(device.NewMailboxes(device.RequestKey("Room")).Intercept)
+	device.NewBus().Integrate(client, router)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	returned := make(chan error, 1)
+	go func() {
+		returned <- client.Invoke(ctx, &message.Message{
+			Route:    route.NewChainRoute(device.Addr(client), style.GoogleChain("/game/play")),
+			Encoding: e1,
+			Data:     encoding.Encode(e1, &Move{Room: "a"}),
+		}, device.NewFuncProcessor(func(context.Context, *message.Message) error {
+			return nil
+		}))
+	}()
+	<-slow.started
+
+	// The handler owns the request until it returns, so its caller waits
+	cancel()
+	select {
+	case err := <-returned:
+		t.Fatalf("expecting the caller to wait for the running handler, got %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(slow.release)
+	select {
+	case <-returned:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout when waiting for the caller")
+	}
+}
+
+func TestMailboxesUnkeyed(t *testing.T) {
+	boxes := device.NewMailboxes(device.MetadataKey("room-id"))
+
+	// Messages without a key are not serialized behind each other
+	started, release := make(chan struct{}), make(chan struct{})
+	busy := make(chan error, 1)
+	go func() {
+		busy <- boxes.Intercept(context.Background(), &message.Message{}, func(context.Context, *message.Message) error {
+			close(started)
+			<-release
+			return nil
+		})
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := boxes.Intercept(ctx, &message.Message{}, func(context.Context, *message.Message) error {
+		return nil
+	}); err != nil {
+		t.Fatalf("expecting unkeyed message to run at once, got %v", err)
+	}
+	close(release)
+	if err := <-busy; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := boxes.Len(); n != 0 {
+		t.Fatalf("expecting no mailbox for unkeyed messages, got %d", n)
+	}
+}
@@ -0,0 +1,70 @@
+package device
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/acoderup/boost/message"
+	"github.com/acoderup/boost/metrics"
+)
+
+const (
+	metricRequests = "boost_device_requests_total"
+	metricErrors   = "boost_device_errors_total"
+	metricInflight = "boost_device_inflight"
+	metricDuration = "boost_device_duration_seconds"
+)
+
+type metricsObserver struct {
+	requests metrics.Counter
+	errors   metrics.Counter
+	inflight metrics.Gauge
+	duration metrics.Histogram
+}
+
+// Metrics records the requests, errors, in-flight messages and latency of every hop
+// into r, labeled by the route of the hop and its kind, router or handler:
+//
+//	device.Observe(device.Metrics(metrics.Default()))
+func Metrics(r *metrics.Registry) Observer {
+	return &metricsObserver{
+		requests: r.Counter(metricRequests, "Messages processed by the hop.", "route", "kind"),
+		errors:   r.Counter(metricErrors, "Messages failed by the hop.", "route", "kind"),
+		inflight: r.Gauge(metricInflight, "Messages being processed by the hop.", "route", "kind"),
+		duration: r.Histogram(metricDuration, "Time spent by the hop.", nil, "route", "kind"),
+	}
+}
+
+func (m *metricsObserver) Observe(ctx context.Context, hop Device, _ *message.Message) (context.Context, func(error)) {
+	labels := []string{RoutePath(hop), hopKind(hop)}
+	m.requests.Inc(labels...)
+	m.inflight.Add(1, labels...)
+	start := time.Now()
+	return ctx, func(err error) {
+		m.duration.Observe(time.Since(start).Seconds(), labels...)
+		m.inflight.Add(-1, labels...)
+		if err != nil {
+			m.errors.Inc(labels...)
+		}
+	}
+}
+
+// RoutePath returns the address of a device as a path, such as "/Server/Echo".
+func RoutePath(d Device) string {
+	addr := Addr(d)
+	if len(addr) <= 1 {
+		return "/"
+	}
+	return "/" + strings.Join(addr[1:], "/")
+}
+
+func hopKind(d Device) string {
+	switch d.(type) {
+	case *Router:
+		return "router"
+	case *Handler:
+		return "handler"
+	}
+	return "device"
+}
@@ -0,0 +1,52 @@
+package device_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/acoderup/boost/device"
+	"github.com/acoderup/boost/metrics"
+)
+
+func TestMetrics(t *testing.T) {
+	r := metrics.NewRegistry()
+	unobserve := device.Observe(device.Metrics(r))
+	defer unobserve()
+
+	client := device.NewClient("Anonymous")
+	router := device.NewRouter("Metered").Integrate(&Flaky{})
+	device.NewBus().Integrate(client, device.NewRouter("Game").Integrate(router))
+	for index := 0; index < 3; index++ {
+		invokeTyped(t, client, "/game/metered/call", e1, []byte(`{}`))
+	}
+	invokeTyped(t, client, "/game/metered/call", e1, []byte(`{`))
+
+	requests := r.Counter("boost_device_requests_total", "", "route", "kind")
+	errors := r.Counter("boost_device_errors_total", "", "route", "kind")
+	if n := requests.Value("/Game/Metered/Call", "handler"); n != 4 {
+		t.Fatalf("expecting 4 handler requests, got %v", n)
+	}
+	if n := errors.Value("/Game/Metered/Call", "handler"); n != 1 {
+		t.Fatalf("expecting 1 handler error, got %v", n)
+	}
+	if n := requests.Value("/Game/Metered", "router"); n != 4 {
+		t.Fatalf("expecting 4 router requests, got %v", n)
+	}
+	if n := r.Gauge("boost_device_inflight", "", "route", "kind").Value("/Game/Metered/Call", "handler"); n != 0 {
+		t.Fatalf("expecting nothing in flight, got %v", n)
+	}
+
+	var buf bytes.Buffer
+	r.WriteTo(&buf)
+	if !strings.Contains(buf.String(), `boost_device_duration_seconds_count{route="/Game/Metered/Call",kind="handler"} 4`) {
+		t.Fatalf("unexpected exposition:\n%s", buf.String())
+	}
+
+	// Removed observers are told about no more hops
+	unobserve()
+	invokeTyped(t, client, "/game/metered/call", e1, []byte(`{}`))
+	if n := requests.Value("/Game/Metered/Call", "handler"); n != 4 {
+		t.Fatalf("expecting no more requests once removed, got %v", n)
+	}
+}
@@ -0,0 +1,79 @@
+package device
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/acoderup/boost/message"
+)
+
+// Observer is told about every Router and Handler hop. Observe is called when the hop
+// starts, and the returned function with the error of the hop when it ends. For
+// handlers the error is the one replied to the caller.
+type Observer interface {
+	Observe(ctx context.Context, hop Device, msg *message.Message) (context.Context, func(error))
+}
+
+var observers struct {
+	sync.Mutex
+	list atomic.Pointer[[]*observer]
+}
+
+// observer is a registration, so the same Observer can be added and removed twice.
+type observer struct {
+	Observer
+}
+
+// Observe adds observers of every hop in the process, and returns the function which
+// removes them.
+func Observe(o ...Observer) func() {
+	added := make([]*observer, 0, len(o))
+	for _, o := range o {
+		added = append(added, &observer{o})
+	}
+	updateObservers(func(list []*observer) []*observer {
+		return append(list, added...)
+	})
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			updateObservers(func(list []*observer) []*observer {
+				return slices.DeleteFunc(list, func(o *observer) bool {
+					return slices.Contains(added, o)
+				})
+			})
+		})
+	}
+}
+
+func updateObservers(update func([]*observer) []*observer) {
+	observers.Lock()
+	defer observers.Unlock()
+
+	var list []*observer
+	if old := observers.list.Load(); old != nil {
+		list = append(list, *old...)
+	}
+	list = update(list)
+	observers.list.Store(&list)
+}
+
+func observe(ctx context.Context, hop Device, msg *message.Message) (context.Context, func(error)) {
+	list := observers.list.Load()
+	if list == nil || len(*list) == 0 {
+		return ctx, func(error) {}
+	}
+
+	ends := make([]func(error), len(*list))
+	for index, o := range *list {
+		ctx, ends[index] = o.Observe(ctx, hop, msg)
+	}
+	return ctx, func(err error) {
+		for index := len(ends) - 1; index >= 0; index-- {
+			ends[index](err)
+		}
+	}
+}
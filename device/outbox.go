@@ -0,0 +1,472 @@
+package device
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/acoderup/boost/message"
+	"github.com/acoderup/boost/timex"
+)
+
+var (
+	ErrOutboxClosed    = errors.New("outbox is closed")
+	ErrOutboxMalformed = errors.New("outbox segment is malformed")
+)
+
+const (
+	outboxPrefix         = "outbox-"
+	outboxExt            = ".seg"
+	defaultOutboxMaxSize = 16 * 1024 * 1024
+)
+
+const (
+	recordAppend byte = iota + 1
+	recordAck
+)
+
+// kind, sequence and payload length, followed by the payload and a CRC32 of the rest
+const recordHeaderSize = 1 + 8 + 4
+
+type OutboxOption func(*OutboxOptions)
+
+// OutboxOptions set the rotation and retention of segments. Only rotated segments whose
+// messages are all acknowledged are ever removed, at once by default, while MaxBackups
+// and MaxAge retain them independently: a segment is removed once either one is
+// exceeded.
+type OutboxOptions struct {
+	// MaxSize is the size in bytes a segment is rotated at.
+	MaxSize int64
+	// MaxBackups is how many acknowledged segments are retained, 0 for no limit.
+	MaxBackups int
+	// MaxAge is how long acknowledged segments are retained since their last write, by
+	// timex.Now, 0 for no limit.
+	MaxAge time.Duration
+}
+
+var defaultOutboxOptions = OutboxOptions{
+	MaxSize: defaultOutboxMaxSize,
+}
+
+// WithOutboxMaxSize sets the size segments are rotated at, a size not positive keeps
+// the default.
+func WithOutboxMaxSize(size int64) OutboxOption {
+	return func(o *OutboxOptions) {
+		if size <= 0 {
+			size = defaultOutboxMaxSize
+		}
+		o.MaxSize = size
+	}
+}
+
+func WithOutboxMaxBackups(backups int) OutboxOption {
+	return func(o *OutboxOptions) {
+		o.MaxBackups = backups
+	}
+}
+
+func WithOutboxMaxAge(age time.Duration) OutboxOption {
+	return func(o *OutboxOptions) {
+		o.MaxAge = age
+	}
+}
+
+// Outbox is a Guard making messages durable: every admitted message is appended to a
+// segment file under a directory before it is dispatched, and acknowledged once the
+// handler succeeds. Messages which are not acknowledged, such as after a crash or a
+// failure, are replayed with Replay, so handlers must tolerate duplicates:
+//
+//	outbox, err := device.NewOutbox("/var/lib/game/outbox")
+//	shop := device.Guarded(device.NewRouter("Shop").Integrate(&Shop{}), outbox)
+//	bus.Integrate(shop)
+//	err = outbox.Replay(ctx, shop)
+//
+// Segments are rotated once they reach MaxSize, and a rotated segment is removed once
+// it and every older segment are acknowledged, unless retained, see OutboxOptions.
+type Outbox struct {
+	OutboxOptions
+	dir      string
+	mutex    sync.Mutex
+	file     *os.File
+	size     int64
+	seq      uint64
+	segments []*segment
+	pending  map[uint64]*outboxEntry
+}
+
+type segment struct {
+	index   uint64
+	pending int
+	modTime time.Time
+}
+
+type outboxEntry struct {
+	segment  *segment
+	envelope []byte
+}
+
+var _ Guard = (*Outbox)(nil)
+
+// NewOutbox opens the outbox under dir, and recovers the messages which have not been
+// acknowledged. A record torn by a crash at the end of the latest segment is dropped.
+func NewOutbox(dir string, opts ...OutboxOption) (*Outbox, error) {
+	o := &Outbox{
+		OutboxOptions: defaultOutboxOptions,
+		dir:           dir,
+		pending:       make(map[uint64]*outboxEntry),
+	}
+	for _, opt := range opts {
+		opt(&o.OutboxOptions)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	if err := o.recover(); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+func (o *Outbox) path(index uint64) string {
+	return filepath.Join(o.dir, fmt.Sprintf("%s%020d%s", outboxPrefix, index, outboxExt))
+}
+
+func (o *Outbox) recover() error {
+	entries, err := os.ReadDir(o.dir)
+	if err != nil {
+		return err
+	}
+	// Modification times are on the wall clock, while ages are by timex.Now
+	skew := timex.Now().Sub(time.Now())
+	for _, entry := range entries {
+		name, ok := strings.CutPrefix(entry.Name(), outboxPrefix)
+		if !ok || entry.IsDir() {
+			continue
+		}
+		name, ok = strings.CutSuffix(name, outboxExt)
+		if !ok {
+			continue
+		}
+		index, err := strconv.ParseUint(name, 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		o.segments = append(o.segments, &segment{index: index, modTime: info.ModTime().Add(skew)})
+	}
+
+	var size int64
+	for position, seg := range o.segments {
+		valid, err := o.read(seg)
+		if err != nil && (!errors.Is(err, ErrOutboxMalformed) || position < len(o.segments)-1) {
+			return err
+		}
+		size = valid
+	}
+
+	if len(o.segments) == 0 {
+		if err := o.open(1); err != nil {
+			return err
+		}
+		o.clean()
+		return nil
+	}
+
+	// Drop whatever follows the last valid record, a full segment is rotated by the
+	// next write
+	last := o.segments[len(o.segments)-1]
+	file, err := os.OpenFile(o.path(last.index), os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := file.Truncate(size); err != nil {
+		file.Close()
+		return err
+	}
+	if _, err := file.Seek(size, io.SeekStart); err != nil {
+		file.Close()
+		return err
+	}
+	o.file, o.size = file, size
+	o.clean()
+	return nil
+}
+
+// read replays the records of seg into the pending messages, and returns the size of
+// its valid records.
+func (o *Outbox) read(seg *segment) (int64, error) {
+	file, err := os.Open(o.path(seg.index))
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	reader := bufio.NewReader(file)
+	var valid int64
+	header := make([]byte, recordHeaderSize)
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			if err == io.EOF {
+				return valid, nil
+			}
+			return valid, fmt.Errorf("%w: %s at %d", ErrOutboxMalformed, file.Name(), valid)
+		}
+		kind := header[0]
+		seq := binary.BigEndian.Uint64(header[1:9])
+		length := int64(recordHeaderSize) + int64(binary.BigEndian.Uint32(header[9:13])) + 4
+		if valid+length > info.Size() {
+			return valid, fmt.Errorf("%w: %s at %d", ErrOutboxMalformed, file.Name(), valid)
+		}
+		record := make([]byte, length)
+		copy(record, header)
+		if _, err := io.ReadFull(reader, record[recordHeaderSize:]); err != nil {
+			return valid, fmt.Errorf("%w: %s at %d", ErrOutboxMalformed, file.Name(), valid)
+		}
+		checksum := binary.BigEndian.Uint32(record[len(record)-4:])
+		if crc32.ChecksumIEEE(record[:len(record)-4]) != checksum {
+			return valid, fmt.Errorf("%w: %s at %d", ErrOutboxMalformed, file.Name(), valid)
+		}
+		valid += int64(len(record))
+
+		o.seq = max(o.seq, seq)
+		switch kind {
+		case recordAppend:
+			o.pending[seq] = &outboxEntry{
+				segment:  seg,
+				envelope: record[recordHeaderSize : len(record)-4],
+			}
+			seg.pending++
+		case recordAck:
+			if entry, ok := o.pending[seq]; ok {
+				entry.segment.pending--
+				delete(o.pending, seq)
+			}
+		}
+	}
+}
+
+func (o *Outbox) open(index uint64) error {
+	file, err := os.OpenFile(o.path(index), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	o.file, o.size = file, 0
+	o.segments = append(o.segments, &segment{index: index, modTime: timex.Now()})
+	return nil
+}
+
+// rotate opens the next segment, closes the current one and cleans up. The current
+// segment stays open when the next one fails to open, so the next write tries again.
+func (o *Outbox) rotate() error {
+	current := o.file
+	if err := o.open(o.segments[len(o.segments)-1].index + 1); err != nil {
+		return err
+	}
+	o.clean()
+	return current.Close()
+}
+
+// clean removes the rotated segments which are not needed any more. Acknowledgements
+// may be written to later segments than their messages, so only a prefix of segments
+// which are all acknowledged can be removed. Segments failing to be removed are left
+// to the next clean up.
+func (o *Outbox) clean() {
+	settled := 0
+	for settled < len(o.segments)-1 && o.segments[settled].pending == 0 {
+		settled++
+	}
+
+	cutoff := timex.Now().Add(-o.MaxAge)
+	remove := 0
+	for ; remove < settled; remove++ {
+		exceeded := o.MaxBackups == 0 && o.MaxAge == 0
+		if o.MaxBackups > 0 && remove < settled-o.MaxBackups {
+			exceeded = true
+		}
+		if o.MaxAge > 0 && o.segments[remove].modTime.Before(cutoff) {
+			exceeded = true
+		}
+		if !exceeded {
+			break
+		}
+	}
+
+	removed := 0
+	for _, seg := range o.segments[:remove] {
+		if err := os.Remove(o.path(seg.index)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		removed++
+	}
+	o.segments = slices.Delete(o.segments, 0, removed)
+}
+
+// write appends a record to the current segment, rotating it first once it is full.
+func (o *Outbox) write(kind byte, seq uint64, payload []byte, sync bool) error {
+	if o.file == nil {
+		return ErrOutboxClosed
+	}
+	if o.size >= o.MaxSize {
+		if err := o.rotate(); err != nil {
+			return err
+		}
+	}
+
+	record := make([]byte, recordHeaderSize, recordHeaderSize+len(payload)+4)
+	record[0] = kind
+	binary.BigEndian.PutUint64(record[1:9], seq)
+	binary.BigEndian.PutUint32(record[9:13], uint32(len(payload)))
+	record = append(record, payload...)
+	record = binary.BigEndian.AppendUint32(record, crc32.ChecksumIEEE(record))
+
+	if _, err := o.file.Write(record); err != nil {
+		return err
+	}
+	if sync {
+		if err := o.file.Sync(); err != nil {
+			return err
+		}
+	}
+	o.size += int64(len(record))
+	o.segments[len(o.segments)-1].modTime = timex.Now()
+	return nil
+}
+
+type outboxReplayKey struct{}
+
+type outboxReplay struct {
+	outbox *Outbox
+	seq    uint64
+}
+
+// Admit appends msg to the outbox before it is dispatched, and acknowledges it once
+// the handler succeeds. Only appends are synced to disk, an acknowledgement lost in a
+// crash replays the message again.
+func (o *Outbox) Admit(ctx context.Context, msg *message.Message) (func(error), error) {
+	if replay, ok := ctx.Value(outboxReplayKey{}).(outboxReplay); ok && replay.outbox == o {
+		return o.release(replay.seq), nil
+	}
+
+	envelope, err := message.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	seq := o.seq + 1
+	if err := o.write(recordAppend, seq, envelope, true); err != nil {
+		return nil, err
+	}
+	seg := o.segments[len(o.segments)-1]
+	o.seq = seq
+	o.pending[seq] = &outboxEntry{
+		segment:  seg,
+		envelope: envelope,
+	}
+	seg.pending++
+	return o.release(seq), nil
+}
+
+func (o *Outbox) release(seq uint64) func(error) {
+	return func(err error) {
+		if err == nil {
+			o.ack(seq)
+		}
+	}
+}
+
+func (o *Outbox) ack(seq uint64) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	entry, ok := o.pending[seq]
+	if !ok {
+		return
+	}
+	if err := o.write(recordAck, seq, nil, false); err != nil {
+		// Left pending, so the message is replayed rather than lost
+		return
+	}
+	entry.segment.pending--
+	delete(o.pending, seq)
+}
+
+// Replay dispatches the messages which have not been acknowledged through d, the
+// device guarded by the outbox, in the order they were admitted. It is meant to be
+// called on start, before new messages arrive, or to retry failed messages.
+func (o *Outbox) Replay(ctx context.Context, d Device) error {
+	o.mutex.Lock()
+	seqs := slices.Sorted(maps.Keys(o.pending))
+	envelopes := make([][]byte, len(seqs))
+	for index, seq := range seqs {
+		envelopes[index] = o.pending[seq].envelope
+	}
+	o.mutex.Unlock()
+
+	var errs []error
+	for index, seq := range seqs {
+		msg, err := message.Unmarshal(envelopes[index])
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := d.Process(context.WithValue(ctx, outboxReplayKey{}, outboxReplay{outbox: o, seq: seq}), msg); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Len returns how many messages have not been acknowledged.
+func (o *Outbox) Len() int {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	return len(o.pending)
+}
+
+// Segments returns the paths of the segment files, from the oldest.
+func (o *Outbox) Segments() []string {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	paths := make([]string, 0, len(o.segments))
+	for _, seg := range o.segments {
+		paths = append(paths, o.path(seg.index))
+	}
+	return paths
+}
+
+func (o *Outbox) Close() error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if o.file == nil {
+		return nil
+	}
+	err := o.file.Close()
+	o.file = nil
+	return err
+}
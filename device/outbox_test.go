@@ -0,0 +1,165 @@
+package device_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/acoderup/boost/device"
+	"github.com/acoderup/boost/message"
+	"github.com/acoderup/boost/route"
+	"github.com/acoderup/boost/style"
+	"github.com/acoderup/boost/timex"
+)
+
+type Wallet struct {
+	failing atomic.Bool
+	granted []string
+}
+
+func (w *Wallet) Grant(_ context.Context, req *Ping) (*Pong, error) {
+	if w.failing.Load() {
+		return nil, errors.New("wallet is unavailable")
+	}
+	w.granted = append(w.granted, req.Text)
+	return &Pong{Text: req.Text}, nil
+}
+
+func grant(t *testing.T, client *device.Client, text string) {
+	t.Helper()
+	msg := &message.Message{
+		Route:    route.NewChainRoute(device.Addr(client), style.GoogleChain("/wallet/grant")),
+		Encoding: e1,
+		Data:     []byte(`{"Text":"` + text + `"}`),
+	}
+	if err := client.Send(context.Background(), msg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func walletBus(outbox *device.Outbox, wallet *Wallet) (*device.Client, device.Device) {
+	client := device.NewClient("Anonymous").Fallback(device.NewFuncProcessor(func(context.Context, *message.Message) error {
+		return nil
+	}))
+	guarded := device.Guarded(device.NewRouter("Wallet").Integrate(wallet), outbox)
+	device.NewBus().Integrate(client, guarded)
+	return client, guarded
+}
+
+func TestOutbox(t *testing.T) {
+	dir := t.TempDir()
+	outbox, err := device.NewOutbox(dir, device.WithOutboxMaxSize(256))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wallet := &Wallet{}
+	client, _ := walletBus(outbox, wallet)
+
+	wallet.failing.Store(true)
+	grant(t, client, "lost")
+	wallet.failing.Store(false)
+	for range 8 {
+		grant(t, client, "gold")
+	}
+	if outbox.Len() != 1 || len(wallet.granted) != 8 {
+		t.Fatalf("expecting 1 pending message and 8 grants, got %d and %d", outbox.Len(), len(wallet.granted))
+	}
+	// The segment of the pending message and every later one are kept
+	segments := outbox.Segments()
+	if len(segments) < 3 {
+		t.Fatalf("expecting segments to rotate, got %v", segments)
+	}
+	outbox.Close()
+
+	// A record torn by a crash is dropped on restart
+	file, _ := os.OpenFile(segments[len(segments)-1], os.O_WRONLY|os.O_APPEND, 0o644)
+	file.Write([]byte{1, 0, 0})
+	file.Close()
+
+	outbox, err = device.NewOutbox(dir, device.WithOutboxMaxSize(256))
+	if err != nil {
+		t.Fatalf("unexpected error reopening: %v", err)
+	}
+	defer outbox.Close()
+	if outbox.Len() != 1 {
+		t.Fatalf("expecting 1 message to be recovered, got %d", outbox.Len())
+	}
+
+	wallet = &Wallet{}
+	client, guarded := walletBus(outbox, wallet)
+	if err := outbox.Replay(context.Background(), guarded); err != nil {
+		t.Fatalf("unexpected error replaying: %v", err)
+	}
+	if outbox.Len() != 0 || len(wallet.granted) != 1 || wallet.granted[0] != "lost" {
+		t.Fatalf("expecting the lost grant to be replayed, got %v with %d pending", wallet.granted, outbox.Len())
+	}
+
+	// Acknowledged segments are removed once the next rotation happens
+	for range 4 {
+		grant(t, client, "gold")
+	}
+	if rest := outbox.Segments(); len(rest) > 2 || rest[0] == segments[0] {
+		t.Fatalf("expecting acknowledged segments to be removed, got %v", rest)
+	}
+}
+
+func TestOutboxRetention(t *testing.T) {
+	t.Cleanup(func() {
+		timex.Init(`{}`)
+	})
+	timex.Init(`{}`)
+
+	open := func(opts ...device.OutboxOption) (*device.Outbox, *device.Client) {
+		outbox, err := device.NewOutbox(t.TempDir(), opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			outbox.Close()
+		})
+		client, _ := walletBus(outbox, &Wallet{})
+		return outbox, client
+	}
+
+	// A size not positive keeps the default, so nothing rotates
+	outbox, client := open(device.WithOutboxMaxSize(0))
+	for range 8 {
+		grant(t, client, "gold")
+	}
+	if segments := outbox.Segments(); len(segments) != 1 {
+		t.Fatalf("expecting a single segment, got %v", segments)
+	}
+
+	outbox, client = open(device.WithOutboxMaxSize(256), device.WithOutboxMaxBackups(2))
+	for range 16 {
+		grant(t, client, "gold")
+	}
+	// The latest rotation may be written by the acknowledgement of a message before it
+	if segments := outbox.Segments(); len(segments) < 3 || len(segments) > 4 {
+		t.Fatalf("expecting 2 acknowledged segments retained, got %v", segments)
+	}
+
+	// The age applies without a number of backups
+	outbox, client = open(device.WithOutboxMaxSize(256), device.WithOutboxMaxAge(time.Hour))
+	for range 8 {
+		grant(t, client, "gold")
+	}
+	segments := outbox.Segments()
+	if len(segments) < 3 {
+		t.Fatalf("expecting young acknowledged segments to be retained, got %v", segments)
+	}
+	timex.Init(`{"fake":"2h"}`)
+	for range 4 {
+		grant(t, client, "gold")
+	}
+	// Only the segment written since time advanced is left of the earlier ones
+	if rest := outbox.Segments(); slices.ContainsFunc(segments[:len(segments)-1], func(path string) bool {
+		return slices.Contains(rest, path)
+	}) {
+		t.Fatalf("expecting old acknowledged segments to be removed, got %v", rest)
+	}
+}
@@ -0,0 +1,96 @@
+package device_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/acoderup/boost/device"
+	"github.com/acoderup/boost/message"
+	"github.com/acoderup/boost/route"
+)
+
+type Seat struct {
+	Room string `json:"room"`
+	File string `json:"file"`
+}
+
+type Seats struct{}
+
+func (*Seats) Join(ctx context.Context, _ *Ping) (*Seat, error) {
+	return &Seat{Room: device.ParamFrom(ctx, "roomID")}, nil
+}
+
+type Lobby struct{}
+
+func (*Lobby) Join(context.Context, *Ping) (*Seat, error) {
+	return &Seat{Room: "lobby"}, nil
+}
+
+type Guests struct{}
+
+func (*Guests) Kick(ctx context.Context, _ *Ping) (*Seat, error) {
+	return &Seat{Room: "guest " + device.ParamFrom(ctx, "guestID")}, nil
+}
+
+type Files struct{}
+
+func (*Files) Get(ctx context.Context, _ *Ping) (*Seat, error) {
+	return &Seat{Room: device.ParamFrom(ctx, "roomID"), File: device.ParamFrom(ctx, route.Wildcard)}, nil
+}
+
+func join(t *testing.T, client *device.Client, path string) (*Seat, error) {
+	t.Helper()
+	p, err := route.NewPathRoute(device.Addr(client), path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	msg := &message.Message{Route: *p, Encoding: e1, Data: []byte(`{}`)}
+
+	var resp *message.Message
+	if err := client.Invoke(context.Background(), msg, device.NewFuncProcessor(func(_ context.Context, m *message.Message) error {
+		resp = m
+		return nil
+	})); err != nil {
+		return nil, err
+	}
+	if err := device.ErrorOf(resp); err != nil {
+		return nil, err
+	}
+	seat := &Seat{}
+	if err := e1.Unmarshal(resp.Data, seat); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return seat, nil
+}
+
+func TestPathRouting(t *testing.T) {
+	client := device.NewClient("Anonymous")
+	room := device.NewRouter("Room").Integrate(
+		device.NewRouter("{roomID}").Integrate(&Seats{}, device.NewRouter(route.Wildcard).Integrate(&Files{})),
+		device.NewRouter("Lobby").Integrate(&Lobby{}),
+		device.NewRouter("{guestID}").Integrate(&Guests{}),
+	)
+	device.NewBus().Integrate(client, room)
+
+	cases := []struct {
+		path string
+		seat Seat
+	}{
+		{"/room/Hall-42/join", Seat{Room: "Hall-42"}},
+		{"/room/lobby/join", Seat{Room: "lobby"}},
+		{"/room/7/notes.txt/get", Seat{Room: "7", File: "notes.txt"}},
+		{"/room/Ann/kick", Seat{Room: "guest Ann"}},
+	}
+	for _, c := range cases {
+		seat, err := join(t, client, c.path)
+		if err != nil || *seat != c.seat {
+			t.Fatalf("expecting %+v for %s, got %+v: %v", c.seat, c.path, seat, err)
+		}
+	}
+
+	for _, path := range []string{"/hall/42/join", "/room/42/leave"} {
+		if _, err := join(t, client, path); err == nil {
+			t.Fatalf("expecting an error for a missing device along %s", path)
+		}
+	}
+}
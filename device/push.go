@@ -0,0 +1,24 @@
+package device
+
+import (
+	"context"
+
+	"github.com/acoderup/boost/encoding"
+	"github.com/acoderup/boost/message"
+	"github.com/acoderup/boost/route"
+)
+
+// Push sends v from the device to the address of a client, as returned by Addr or
+// CallerFrom. Pushed messages have ID 0, clients hand them to their fallback.
+func Push(ctx context.Context, from Device, to []string, e encoding.Encoding, v interface{}, md message.Metadata) error {
+	data, err := e.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return from.Process(ctx, &message.Message{
+		Route:    route.NewChainRoute(Addr(from), to),
+		Encoding: e,
+		Metadata: md,
+		Data:     data,
+	})
+}
@@ -0,0 +1,66 @@
+package device
+
+import (
+	"reflect"
+	"sort"
+
+	"github.com/acoderup/boost/stringx"
+)
+
+// HandlerInfo describes a handler and the JSON Schema of its request and response.
+type HandlerInfo struct {
+	Name      string  `json:"name"`
+	Path      string  `json:"path"`
+	Mode      string  `json:"mode"`
+	Version   string  `json:"version,omitempty"`
+	Signature string  `json:"signature"`
+	Request   *Schema `json:"request,omitempty"`
+	Response  *Schema `json:"response,omitempty"`
+
+	RequestType  reflect.Type `json:"-"`
+	ResponseType reflect.Type `json:"-"`
+}
+
+// Handlers returns the handlers under the router and the routers nested in it, sorted
+// by their route paths, versions of the same handler are listed from the oldest.
+func (r *Router) Handlers() []HandlerInfo {
+	var infos []HandlerInfo
+	var walk func(d Device)
+	walk = func(d Device) {
+		if g, ok := d.(*guarded); ok {
+			d = g.Unwrap()
+		}
+		if v, ok := d.(*versioned); ok {
+			d = v.Unwrap()
+		}
+		switch d := d.(type) {
+		case *Handler:
+			req, resp := d.Types()
+			infos = append(infos, HandlerInfo{
+				Name:      d.String(),
+				Path:      RoutePath(d),
+				Mode:      d.Mode(),
+				Version:   d.Version(),
+				Signature: d.Signature(),
+				Request:   SchemaOf(req),
+				Response:  SchemaOf(resp),
+
+				RequestType:  req,
+				ResponseType: resp,
+			})
+		case *Router:
+			for _, child := range children(d) {
+				walk(child)
+			}
+		}
+	}
+	walk(r)
+
+	sort.SliceStable(infos, func(i, j int) bool {
+		if infos[i].Path != infos[j].Path {
+			return infos[i].Path < infos[j].Path
+		}
+		return stringx.CompareVersion(infos[i].Version, infos[j].Version) < 0
+	})
+	return infos
+}
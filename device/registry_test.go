@@ -0,0 +1,91 @@
+package device_test
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/acoderup/boost/device"
+)
+
+type Record struct {
+	ID      int64     `json:"id,string"`
+	Created time.Time `json:"created"`
+}
+
+type Member struct {
+	Record
+	Name     string            `json:"name"`
+	Nickname string            `json:"nickname,omitempty"`
+	Tags     map[string]string `json:"tags,omitempty"`
+	Friends  []*Member         `json:"friends,omitempty"`
+	Secret   string            `json:"-"`
+	internal string
+}
+
+type Club struct{}
+
+func (*Club) Join(_ context.Context, req *Member) (*Member, error) {
+	return req, nil
+}
+
+func (*Club) Leave(context.Context, *Ping) error {
+	return nil
+}
+
+// Count and Find are helpers, not handlers, since they cannot fail with an error.
+func (*Club) Count(context.Context, *Ping) int {
+	return 0
+}
+
+func (*Club) Find(context.Context, *Ping) (*Member, bool) {
+	return nil, false
+}
+
+func TestSchemaOf(t *testing.T) {
+	schema := device.SchemaOf(reflect.TypeOf(&Member{}))
+	if schema.Ref != "#/$defs/Member" {
+		t.Fatalf("unexpected ref %q", schema.Ref)
+	}
+	member := schema.Defs["Member"]
+	if member == nil || member.Type != "object" {
+		t.Fatalf("unexpected definitions %+v", schema.Defs)
+	}
+
+	data, _ := json.Marshal(member)
+	expected := `{"type":"object","properties":{` +
+		`"created":{"type":"string","format":"date-time"},` +
+		`"friends":{"type":"array","items":{"$ref":"#/$defs/Member"}},` +
+		`"id":{"type":"string"},` +
+		`"name":{"type":"string"},` +
+		`"nickname":{"type":"string"},` +
+		`"tags":{"type":"object","additionalProperties":{"type":"string"}}},` +
+		`"required":["name","id","created"]}`
+	if string(data) != expected {
+		t.Fatalf("unexpected schema\n%s\nexpecting\n%s", data, expected)
+	}
+}
+
+func TestRouterHandlers(t *testing.T) {
+	router := device.NewRouter("Club").Integrate(&Club{}, device.NewRouter("Lobby").Integrate(&Flaky{}))
+	device.NewBus().Integrate(router)
+
+	infos := router.Handlers()
+	paths := make([]string, len(infos))
+	for index, info := range infos {
+		paths[index] = info.Path
+	}
+	if !reflect.DeepEqual(paths, []string{"/Club/Join", "/Club/Leave", "/Club/Lobby/Call"}) {
+		t.Fatalf("unexpected handlers %v", paths)
+	}
+
+	join, leave := infos[0], infos[1]
+	if join.Mode != "unary" || join.Request.Ref != "#/$defs/Member" || join.Response.Ref != "#/$defs/Member" {
+		t.Fatalf("unexpected handler %+v", join)
+	}
+	if leave.Mode != "one-way" || leave.Response != nil || leave.Request.Defs["Ping"] == nil {
+		t.Fatalf("unexpected handler %+v", leave)
+	}
+}
@@ -2,6 +2,7 @@ package device
 
 import (
 	"context"
+	"slices"
 
 	"github.com/acoderup/boost/magic"
 	"github.com/acoderup/boost/message"
@@ -9,8 +10,12 @@ import (
 
 type Router struct {
 	*Base
-	name string
-	bus  bool
+	name         string
+	bus          bool
+	interceptors []Interceptor
+	topics       map[string][]subscription
+	deadLetters  DeadLetterSink
+	guards       map[string][]Guard
 }
 
 func NewRouter(name string) *Router {
@@ -32,18 +37,34 @@ func Bus() *Router {
 	return bus
 }
 
+// Extend adds device to its group, behind the guards of the group if any.
+func (r *Router) Extend(device Device) {
+	r.rwMutex.Lock()
+	defer r.rwMutex.Unlock()
+
+	if guards := r.guards[device.String()]; len(guards) > 0 {
+		device = Guarded(device, guards...)
+	}
+	r.extend(device)
+}
+
 func (r *Router) String() string {
 	return r.name
 }
 
 func (r *Router) Process(ctx context.Context, msg *message.Message) error {
+	// Every router counts a hop, so a loop of gateways fails fast
+	if !hop(msg) {
+		return r.undeliverable(msg, ErrRouteHopLimit)
+	}
+
 	if r.bus {
 		if !msg.Route.Dispatching() {
 			msg.Route = msg.Route.Forward()
 			return r.localProcess(ctx, msg)
 		}
 
-		return msg.Route.Error(ErrRouteDeadEnd)
+		return r.undeliverable(msg, ErrRouteDeadEnd)
 	}
 
 	if !msg.Route.Dispatching() {
@@ -57,11 +78,16 @@ func (r *Router) Process(ctx context.Context, msg *message.Message) error {
 }
 
 func (r *Router) localProcess(ctx context.Context, msg *message.Message) error {
-	device := r.Locate(msg.Route.Position())
+	device, done, err := r.pick(ctx, msg.Route.Position(), msg)
 	if device == nil {
-		return msg.Route.Error(ErrRouteMissingDevice)
+		return r.undeliverable(msg, err)
 	}
-	return device.Process(ctx, msg)
+	defer done()
+
+	ctx, end := observe(ctx, r, msg)
+	err = device.Process(ctx, msg)
+	end(err)
+	return err
 }
 
 func (r *Router) Integrate(targetList ...interface{}) *Router {
@@ -79,7 +105,48 @@ func (r *Router) Integrate(targetList ...interface{}) *Router {
 	return r
 }
 
+// Use appends interceptors inherited by every handler under the router.
+func (r *Router) Use(interceptors ...Interceptor) *Router {
+	r.rwMutex.Lock()
+	defer r.rwMutex.Unlock()
+
+	r.interceptors = slices.Concat(r.interceptors, interceptors)
+	return r
+}
+
+func (r *Router) chain() []Interceptor {
+	r.rwMutex.RLock()
+	defer r.rwMutex.RUnlock()
+
+	return r.interceptors
+}
+
+// Override replaces the inherited interceptors of the handlers called name.
+func (r *Router) Override(name string, interceptors ...Interceptor) *Router {
+	r.rwMutex.RLock()
+	defer r.rwMutex.RUnlock()
+
+	for _, device := range r.devices[name] {
+		// Handlers may be wrapped by guards and versions
+		if h, ok := unwrap(device).(*Handler); ok {
+			h.Use(interceptors...)
+		}
+	}
+	return r
+}
+
+// Balance sets the balancer of the groups called names, or of all groups when no
+// name is given.
+func (r *Router) Balance(balancer Balancer, names ...string) *Router {
+	r.Base.Balance(balancer, names...)
+	return r
+}
+
 func (r *Router) AsBus() *Router {
 	r.bus = true
 	return r
 }
+
+func (r *Router) IsBus() bool {
+	return r.bus
+}
@@ -245,3 +245,45 @@ func TestRouter3(t *testing.T) {
 		}
 	}
 }
+
+type Meta struct{}
+
+func (*Meta) Whoami(ctx context.Context, _ *Ping) (*Pong, error) {
+	md := device.MetadataFrom(ctx)
+	if device.RequestFrom(ctx).Metadata.Get(message.MetadataUserID) != md.Get(message.MetadataUserID) {
+		return nil, fmt.Errorf("metadata mismatch")
+	}
+	return &Pong{Text: md.Get(message.MetadataUserID)}, nil
+}
+
+func TestRouterMetadata(t *testing.T) {
+	client := device.NewClient("Anonymous")
+	device.NewBus().Integrate(client, device.NewRouter("Meta").Integrate(&Meta{}))
+
+	var resp *message.Message
+	err := client.Invoke(context.Background(), &message.Message{
+		Route:    route.NewChainRoute(device.Addr(client), style.GoogleChain("/meta/whoami")),
+		Encoding: e1,
+		Metadata: message.Metadata{
+			message.MetadataUserID:  "libra",
+			message.MetadataTraceID: "trace",
+			message.MetadataAuth:    "token",
+		},
+		Data: encoding.Encode(e1, &Ping{}),
+	}, device.NewFuncProcessor(func(_ context.Context, msg *message.Message) error {
+		resp = msg
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error getting from device: %v", err)
+	}
+
+	pong := &Pong{}
+	encoding.Decode(e1, resp.Data, pong)
+	if pong.Text != "libra" {
+		t.Fatalf("expecting handler to see user id, got %q", pong.Text)
+	}
+	if resp.Metadata.Get(message.MetadataTraceID) != "trace" || resp.Metadata.Get(message.MetadataAuth) != "" {
+		t.Fatalf("unexpected response metadata %v", resp.Metadata)
+	}
+}
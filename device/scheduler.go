@@ -0,0 +1,377 @@
+package device
+
+import (
+	"cmp"
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/acoderup/boost/message"
+	"github.com/acoderup/boost/safe"
+	"github.com/acoderup/boost/timex"
+)
+
+var (
+	ErrScheduleNotFound    = errors.New("schedule cannot be found by ID")
+	ErrScheduleNotRestored = errors.New("scheduler has not restored its store")
+)
+
+const (
+	defaultScheduleInterval = 10 * time.Millisecond
+	defaultScheduleRetry    = time.Second
+)
+
+// Schedule is a message waiting to be delivered at Due.
+type Schedule struct {
+	ID      uint64
+	Due     time.Time
+	Message *message.Message
+}
+
+// ScheduleStore persists pending schedules, so they survive a restart. A schedule is
+// saved when it is made, and deleted once it is delivered or canceled. LastID returns
+// the greatest ID ever saved, so IDs of deleted schedules are never given again.
+type ScheduleStore interface {
+	Save(Schedule) error
+	Delete(id uint64) error
+	Load() ([]Schedule, error)
+	LastID() (uint64, error)
+}
+
+type SchedulerOption func(*SchedulerOptions)
+
+type SchedulerOptions struct {
+	Store    ScheduleStore
+	Interval time.Duration
+	Retry    time.Duration
+}
+
+var defaultSchedulerOptions = SchedulerOptions{
+	Interval: defaultScheduleInterval,
+	Retry:    defaultScheduleRetry,
+}
+
+// WithScheduleStore sets where pending schedules are persisted, see Restore.
+func WithScheduleStore(store ScheduleStore) SchedulerOption {
+	return func(o *SchedulerOptions) {
+		o.Store = store
+	}
+}
+
+// WithScheduleInterval sets how often due times are checked against timex.Now, a
+// duration not positive keeps the default.
+func WithScheduleInterval(d time.Duration) SchedulerOption {
+	return func(o *SchedulerOptions) {
+		if d <= 0 {
+			d = defaultScheduleInterval
+		}
+		o.Interval = d
+	}
+}
+
+// WithScheduleRetry sets how long a schedule which fails to be delivered waits before
+// it is tried again, a duration not positive keeps the default.
+func WithScheduleRetry(d time.Duration) SchedulerOption {
+	return func(o *SchedulerOptions) {
+		if d <= 0 {
+			d = defaultScheduleRetry
+		}
+		o.Retry = d
+	}
+}
+
+// Scheduler delivers messages at a later time, it is integrated into the bus and hands
+// due messages to the bus for normal routing, replies go to the source of their route.
+// Due times are compared with timex.Now, so fake and virtual time are honored:
+//
+//	scheduler := device.NewScheduler("Scheduler")
+//	device.NewBus().Integrate(client, room, scheduler)
+//	id, err := scheduler.After(msg, 30*time.Second)
+//
+// A scheduler with a store must Restore before scheduling, so IDs never collide with
+// persisted ones.
+type Scheduler struct {
+	*Base
+	SchedulerOptions
+	name     string
+	mutex    sync.Mutex
+	queue    scheduleQueue
+	entries  map[uint64]*scheduleEntry
+	lastID   uint64
+	polling  int32
+	restored int32
+}
+
+type scheduleEntry struct {
+	Schedule
+	index int
+}
+
+func NewScheduler(name string, opts ...SchedulerOption) *Scheduler {
+	s := &Scheduler{
+		Base:             NewBase(),
+		SchedulerOptions: defaultSchedulerOptions,
+		name:             name,
+		entries:          make(map[uint64]*scheduleEntry),
+	}
+	for _, opt := range opts {
+		opt(&s.SchedulerOptions)
+	}
+	return s
+}
+
+func (s *Scheduler) String() string {
+	return s.name
+}
+
+// Join starts delivering the pending schedules, which wait while there is no gateway.
+func (s *Scheduler) Join(device Device) {
+	s.mutex.Lock()
+	s.Base.Join(device)
+	s.mutex.Unlock()
+
+	s.poll()
+}
+
+func (s *Scheduler) Gateway() Device {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.gateway
+}
+
+// Process passes messages on to the gateway, nothing is routed under a scheduler.
+func (s *Scheduler) Process(ctx context.Context, msg *message.Message) error {
+	if msg.Route.Dispatching() {
+		return msg.Route.Error(ErrRouteDeadEnd)
+	}
+	gateway := s.Gateway()
+	if gateway == nil {
+		return ErrGatewayNotFound
+	}
+	return gateway.Process(ctx, msg)
+}
+
+// At schedules msg to be delivered at due and returns the ID of the schedule, msg is
+// copied so it may be reused. A due time which has passed is delivered at once. With a
+// store, it returns ErrScheduleNotRestored until Restore succeeds.
+func (s *Scheduler) At(msg *message.Message, due time.Time) (uint64, error) {
+	if s.Store != nil && atomic.LoadInt32(&s.restored) == 0 {
+		return 0, ErrScheduleNotRestored
+	}
+	copied := *msg
+	copied.Metadata = msg.Metadata.Clone()
+	schedule := Schedule{
+		ID:      atomic.AddUint64(&s.lastID, 1),
+		Due:     due,
+		Message: &copied,
+	}
+	if s.Store != nil {
+		if err := s.Store.Save(schedule); err != nil {
+			return 0, err
+		}
+	}
+	s.push(schedule)
+	return schedule.ID, nil
+}
+
+// After schedules msg to be delivered once d has elapsed from timex.Now.
+func (s *Scheduler) After(msg *message.Message, d time.Duration) (uint64, error) {
+	return s.At(msg, timex.Now().Add(d))
+}
+
+// Cancel removes the pending schedule, it returns ErrScheduleNotFound if the schedule
+// has already been delivered or canceled.
+func (s *Scheduler) Cancel(id uint64) error {
+	s.mutex.Lock()
+	entry, ok := s.entries[id]
+	if ok {
+		heap.Remove(&s.queue, entry.index)
+		delete(s.entries, id)
+	}
+	s.mutex.Unlock()
+
+	if !ok {
+		return ErrScheduleNotFound
+	}
+	if s.Store != nil {
+		return s.Store.Delete(id)
+	}
+	return nil
+}
+
+// Restore schedules again the pending schedules of the store, such as after a restart,
+// IDs keep counting from the greatest restored one.
+func (s *Scheduler) Restore() error {
+	if s.Store == nil {
+		return nil
+	}
+	schedules, err := s.Store.Load()
+	if err != nil {
+		return err
+	}
+	lastID, err := s.Store.LastID()
+	if err != nil {
+		return err
+	}
+	for _, schedule := range schedules {
+		lastID = max(lastID, schedule.ID)
+	}
+	for {
+		last := atomic.LoadUint64(&s.lastID)
+		if lastID <= last || atomic.CompareAndSwapUint64(&s.lastID, last, lastID) {
+			break
+		}
+	}
+	for _, schedule := range schedules {
+		s.push(schedule)
+	}
+	atomic.StoreInt32(&s.restored, 1)
+	return nil
+}
+
+// Pending returns the pending schedules, from the earliest due.
+func (s *Scheduler) Pending() []Schedule {
+	s.mutex.Lock()
+	schedules := make([]Schedule, 0, len(s.queue))
+	for _, entry := range s.queue {
+		schedules = append(schedules, entry.Schedule)
+	}
+	s.mutex.Unlock()
+
+	slices.SortFunc(schedules, compareSchedules)
+	return schedules
+}
+
+func (s *Scheduler) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return len(s.entries)
+}
+
+// Poll delivers the schedules due by timex.Now and returns how many were delivered,
+// it is called periodically while schedules are pending. A schedule which fails to be
+// delivered is kept and tried again after the retry delay, until it is delivered or
+// canceled. Delivery failures are returned, as are failures to delete delivered
+// schedules from the store, which would be delivered again once restored.
+func (s *Scheduler) Poll() (int, error) {
+	gateway := s.Gateway()
+	if gateway == nil {
+		return 0, nil
+	}
+
+	now := timex.Now()
+	var due []Schedule
+	s.mutex.Lock()
+	for len(s.queue) > 0 && !s.queue[0].Due.After(now) {
+		entry := heap.Pop(&s.queue).(*scheduleEntry)
+		delete(s.entries, entry.ID)
+		due = append(due, entry.Schedule)
+	}
+	s.mutex.Unlock()
+
+	var delivered int
+	var errs []error
+	for _, schedule := range due {
+		// Messages are processed by the bus, which also keeps dead letters of failures
+		if err := safe.Do(func() error {
+			return gateway.Process(context.Background(), schedule.Message)
+		}); err != nil {
+			errs = append(errs, fmt.Errorf("schedule %d: %w", schedule.ID, err))
+			schedule.Due = now.Add(s.Retry)
+			s.push(schedule)
+			continue
+		}
+		delivered++
+		if s.Store != nil {
+			if err := s.Store.Delete(schedule.ID); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return delivered, errors.Join(errs...)
+}
+
+func (s *Scheduler) push(schedule Schedule) {
+	s.mutex.Lock()
+	if _, ok := s.entries[schedule.ID]; ok {
+		s.mutex.Unlock()
+		return
+	}
+	entry := &scheduleEntry{Schedule: schedule}
+	heap.Push(&s.queue, entry)
+	s.entries[schedule.ID] = entry
+	s.mutex.Unlock()
+
+	s.poll()
+}
+
+func (s *Scheduler) poll() {
+	if !atomic.CompareAndSwapInt32(&s.polling, 0, 1) {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(s.Interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if s.Len() == 0 || s.Gateway() == nil {
+				// Stop when idle or not joined, unless a schedule or a gateway arrived
+				// while stopping, Join polls again.
+				atomic.StoreInt32(&s.polling, 0)
+				if s.Len() == 0 || s.Gateway() == nil || !atomic.CompareAndSwapInt32(&s.polling, 0, 1) {
+					return
+				}
+			}
+			if _, err := s.Poll(); err != nil {
+				log.Printf("scheduler %s: %v", s.name, err)
+			}
+		}
+	}()
+}
+
+// scheduleQueue is a heap of entries by due time, then by ID.
+type scheduleQueue []*scheduleEntry
+
+func (q scheduleQueue) Len() int {
+	return len(q)
+}
+
+func (q scheduleQueue) Less(i, j int) bool {
+	return compareSchedules(q[i].Schedule, q[j].Schedule) < 0
+}
+
+func compareSchedules(a, b Schedule) int {
+	if n := a.Due.Compare(b.Due); n != 0 {
+		return n
+	}
+	return cmp.Compare(a.ID, b.ID)
+}
+
+func (q scheduleQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *scheduleQueue) Push(x any) {
+	entry := x.(*scheduleEntry)
+	entry.index = len(*q)
+	*q = append(*q, entry)
+}
+
+func (q *scheduleQueue) Pop() any {
+	old := *q
+	entry := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	return entry
+}
@@ -0,0 +1,157 @@
+package device_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/acoderup/boost/device"
+	"github.com/acoderup/boost/message"
+	"github.com/acoderup/boost/route"
+	"github.com/acoderup/boost/style"
+	"github.com/acoderup/boost/timex"
+)
+
+type Buff struct {
+	expired chan string
+}
+
+func (b *Buff) Expire(_ context.Context, req *Ping) error {
+	b.expired <- req.Text
+	return nil
+}
+
+func expire(text string) *message.Message {
+	return &message.Message{
+		Route:    route.NewChainRoute(nil, style.GoogleChain("/buff/expire")),
+		Encoding: e1,
+		Data:     []byte(`{"Text":"` + text + `"}`),
+	}
+}
+
+func expect(t *testing.T, expired <-chan string, text string) {
+	t.Helper()
+	select {
+	case got := <-expired:
+		if got != text {
+			t.Fatalf("expecting %q to expire, got %q", text, got)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expecting %q to expire", text)
+	}
+}
+
+func TestScheduler(t *testing.T) {
+	buff := &Buff{expired: make(chan string, 4)}
+	scheduler := device.NewScheduler("Scheduler")
+	device.NewBus().Integrate(device.NewRouter("Buff").Integrate(buff), scheduler)
+
+	later, _ := scheduler.After(expire("later"), time.Hour)
+	soon, _ := scheduler.After(expire("soon"), 20*time.Millisecond)
+	if pending := scheduler.Pending(); len(pending) != 2 || pending[0].ID != soon || pending[1].ID != later {
+		t.Fatalf("unexpected pending schedules %+v", pending)
+	}
+
+	expect(t, buff.expired, "soon")
+	if err := scheduler.Cancel(later); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := scheduler.Cancel(soon); !errors.Is(err, device.ErrScheduleNotFound) {
+		t.Fatalf("expecting delivered schedule not to be found, got %v", err)
+	}
+	if scheduler.Len() != 0 {
+		t.Fatalf("expecting no pending schedule, got %d", scheduler.Len())
+	}
+
+	// A due time which has passed is delivered at once
+	scheduler.At(expire("overdue"), timex.Now().Add(-time.Minute))
+	expect(t, buff.expired, "overdue")
+}
+
+func TestSchedulerRestore(t *testing.T) {
+	store, err := device.NewFileScheduleStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Schedules are not delivered before the scheduler joins a bus
+	before := device.NewScheduler("Scheduler", device.WithScheduleStore(store))
+	if _, err := before.After(expire("early"), time.Hour); !errors.Is(err, device.ErrScheduleNotRestored) {
+		t.Fatalf("expecting scheduling before restoring to fail, got %v", err)
+	}
+	if err := before.Restore(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	canceled, _ := before.After(expire("canceled"), time.Hour)
+	restored, _ := before.After(expire("restored"), 50*time.Millisecond)
+	before.Cancel(canceled)
+
+	buff := &Buff{expired: make(chan string, 4)}
+	after := device.NewScheduler("Scheduler", device.WithScheduleStore(store))
+	device.NewBus().Integrate(device.NewRouter("Buff").Integrate(buff), after)
+	if err := after.Restore(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pending := after.Pending(); len(pending) != 1 || pending[0].ID != restored {
+		t.Fatalf("unexpected restored schedules %+v", pending)
+	}
+	next, _ := after.After(expire("next"), time.Hour)
+	if next <= restored {
+		t.Fatalf("expecting IDs to count from %d, got %d", restored, next)
+	}
+
+	expect(t, buff.expired, "restored")
+	if schedules, _ := store.Load(); len(schedules) != 1 {
+		t.Fatalf("expecting only the next schedule to be stored, got %+v", schedules)
+	}
+	after.Cancel(next)
+
+	// IDs of schedules which are gone are never given again
+	again := device.NewScheduler("Scheduler", device.WithScheduleStore(store))
+	if err := again.Restore(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if id, _ := again.After(expire("again"), time.Hour); id <= next {
+		t.Fatalf("expecting IDs to count from %d, got %d", next, id)
+	}
+}
+
+func TestSchedulerVirtualTime(t *testing.T) {
+	t.Cleanup(func() {
+		timex.Init(`{}`)
+	})
+	timex.Init(`{}`)
+
+	// The poller never ticks, due times are checked by polling after time is advanced
+	buff := &Buff{expired: make(chan string, 4)}
+	scheduler := device.NewScheduler("Scheduler", device.WithScheduleInterval(time.Hour))
+	scheduler.After(expire("tomorrow"), 24*time.Hour)
+	if n, err := scheduler.Poll(); n != 0 || err != nil {
+		t.Fatalf("expecting nothing delivered without a bus, got %d: %v", n, err)
+	}
+	device.NewBus().Integrate(device.NewRouter("Buff").Integrate(buff), scheduler)
+	if n, _ := scheduler.Poll(); n != 0 {
+		t.Fatalf("expecting nothing due yet, got %d", n)
+	}
+
+	timex.Init(`{"fake":"25h"}`)
+	if n, err := scheduler.Poll(); n != 1 || err != nil {
+		t.Fatalf("expecting the schedule due in virtual time, got %d: %v", n, err)
+	}
+	expect(t, buff.expired, "tomorrow")
+
+	// A schedule failing to be delivered is kept and tried again later
+	missing := expire("missing")
+	missing.Route = route.NewChainRoute(nil, style.GoogleChain("/buff/missing"))
+	id, _ := scheduler.After(missing, 0)
+	if n, err := scheduler.Poll(); n != 0 || !errors.Is(err, device.ErrRouteMissingDevice) {
+		t.Fatalf("expecting the delivery to fail, got %d: %v", n, err)
+	}
+	if pending := scheduler.Pending(); len(pending) != 1 || pending[0].ID != id || !pending[0].Due.After(timex.Now()) {
+		t.Fatalf("expecting the schedule to be retried later, got %+v", pending)
+	}
+	if err := scheduler.Cancel(id); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,160 @@
+package device
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/acoderup/boost/message"
+)
+
+var (
+	ErrScheduleMalformed = errors.New("schedule file is malformed")
+)
+
+const (
+	scheduleExt  = ".schedule"
+	scheduleLast = "last-id"
+)
+
+// FileScheduleStore keeps every pending schedule in a file of its own under a
+// directory, the file holds the due time followed by the message envelope. The
+// greatest ID saved is kept in a file of its own.
+type FileScheduleStore struct {
+	dir    string
+	mutex  sync.Mutex
+	lastID uint64
+	loaded bool
+}
+
+var _ ScheduleStore = (*FileScheduleStore)(nil)
+
+func NewFileScheduleStore(dir string) (*FileScheduleStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileScheduleStore{
+		dir: dir,
+	}, nil
+}
+
+func (f *FileScheduleStore) path(id uint64) string {
+	return filepath.Join(f.dir, fmt.Sprintf("%020d%s", id, scheduleExt))
+}
+
+// Save writes the schedule to a temporary file first, so a crash never leaves a
+// partial schedule behind.
+func (f *FileScheduleStore) Save(schedule Schedule) error {
+	envelope, err := message.Marshal(schedule.Message)
+	if err != nil {
+		return err
+	}
+	data := binary.BigEndian.AppendUint64(nil, uint64(schedule.Due.UnixNano()))
+	data = append(data, envelope...)
+
+	if err := f.saveLastID(schedule.ID); err != nil {
+		return err
+	}
+	return writeFile(f.path(schedule.ID), data)
+}
+
+func (f *FileScheduleStore) saveLastID(id uint64) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	last, err := f.loadLastID()
+	if err != nil || id <= last {
+		return err
+	}
+	if err := writeFile(filepath.Join(f.dir, scheduleLast), binary.BigEndian.AppendUint64(nil, id)); err != nil {
+		return err
+	}
+	f.lastID = id
+	return nil
+}
+
+// LastID returns the greatest ID saved, it is 0 when nothing has been saved.
+func (f *FileScheduleStore) LastID() (uint64, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.loadLastID()
+}
+
+func (f *FileScheduleStore) loadLastID() (uint64, error) {
+	if f.loaded {
+		return f.lastID, nil
+	}
+	data, err := os.ReadFile(filepath.Join(f.dir, scheduleLast))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return 0, err
+	case len(data) != 8:
+		return 0, fmt.Errorf("%w: %s", ErrScheduleMalformed, scheduleLast)
+	default:
+		f.lastID = binary.BigEndian.Uint64(data)
+	}
+	f.loaded = true
+	return f.lastID, nil
+}
+
+// writeFile replaces the file at path through a temporary file.
+func writeFile(path string, data []byte) error {
+	if err := os.WriteFile(path+".tmp", data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func (f *FileScheduleStore) Delete(id uint64) error {
+	if err := os.Remove(f.path(id)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Load reads every schedule under the directory, ordered by ID.
+func (f *FileScheduleStore) Load() ([]Schedule, error) {
+	entries, err := os.ReadDir(f.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var schedules []Schedule
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), scheduleExt)
+		if !ok || entry.IsDir() {
+			continue
+		}
+		id, err := strconv.ParseUint(name, 10, 64)
+		if err != nil {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(f.dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if len(data) < 8 {
+			return nil, fmt.Errorf("%w: %s", ErrScheduleMalformed, entry.Name())
+		}
+		msg, err := message.Unmarshal(data[8:])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrScheduleMalformed, entry.Name(), err)
+		}
+		schedules = append(schedules, Schedule{
+			ID:      id,
+			Due:     time.Unix(0, int64(binary.BigEndian.Uint64(data))),
+			Message: msg,
+		})
+	}
+	return schedules, nil
+}
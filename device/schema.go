@@ -0,0 +1,193 @@
+package device
+
+import (
+	"encoding"
+	"encoding/json"
+	"path"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Schema is the subset of JSON Schema describing what encoding/json produces for a
+// Go type.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Defs                 map[string]*Schema `json:"$defs,omitempty"`
+}
+
+var (
+	typeOfTime          = reflect.TypeOf(time.Time{})
+	typeOfRawMessage    = reflect.TypeOf(json.RawMessage{})
+	typeOfJSONMarshaler = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	typeOfTextMarshaler = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// Schemas generates schemas of Go types, named struct types are defined once and
+// referenced by refPrefix followed by their names, so recursive types terminate.
+type Schemas struct {
+	Definitions map[string]*Schema
+	refPrefix   string
+	names       map[reflect.Type]string
+	taken       map[string]reflect.Type
+}
+
+func NewSchemas(refPrefix string) *Schemas {
+	return &Schemas{
+		Definitions: make(map[string]*Schema),
+		refPrefix:   refPrefix,
+		names:       make(map[reflect.Type]string),
+		taken:       make(map[string]reflect.Type),
+	}
+}
+
+// SchemaOf returns the standalone schema of t, definitions are kept under $defs.
+func SchemaOf(t reflect.Type) *Schema {
+	if t == nil {
+		return nil
+	}
+	schemas := NewSchemas("#/$defs/")
+	schema := schemas.Of(t)
+	if len(schemas.Definitions) > 0 {
+		schema.Defs = schemas.Definitions
+	}
+	return schema
+}
+
+// Of returns the schema of t, honoring the json tags of struct fields.
+func (s *Schemas) Of(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == typeOfTime:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == typeOfRawMessage:
+		return &Schema{}
+	case t.Implements(typeOfJSONMarshaler) || reflect.PointerTo(t).Implements(typeOfJSONMarshaler):
+		return &Schema{}
+	case t.Implements(typeOfTextMarshaler) || reflect.PointerTo(t).Implements(typeOfTextMarshaler):
+		return &Schema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64, reflect.Uintptr:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: s.Of(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: s.Of(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		name, ok := s.names[t]
+		if !ok {
+			name = s.name(t)
+			s.names[t] = name
+			s.Definitions[name] = s.object(t)
+		}
+		return &Schema{Ref: s.refPrefix + name}
+	}
+	// Interfaces accept anything, functions and channels are never encoded
+	return &Schema{}
+}
+
+func (s *Schemas) name(t reflect.Type) string {
+	name := t.Name()
+	if other, ok := s.taken[name]; ok && other != t {
+		name = path.Base(t.PkgPath()) + "." + name
+	}
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, name)
+	s.taken[name] = t
+	return name
+}
+
+func (s *Schemas) object(t reflect.Type) *Schema {
+	schema := &Schema{
+		Type:       "object",
+		Properties: make(map[string]*Schema),
+	}
+	s.fields(schema, t)
+	return schema
+}
+
+func (s *Schemas) fields(schema *Schema, t reflect.Type) {
+	var embedded []reflect.Type
+	for index := 0; index < t.NumField(); index++ {
+		field := t.Field(index)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		ft := field.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if field.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			embedded = append(embedded, ft)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if _, ok := schema.Properties[name]; ok {
+			continue
+		}
+
+		var optional, quoted bool
+		for _, opt := range strings.Split(opts, ",") {
+			switch opt {
+			case "omitempty", "omitzero":
+				optional = true
+			case "string":
+				quoted = true
+			}
+		}
+
+		fs := s.Of(field.Type)
+		if quoted && (fs.Type == "boolean" || fs.Type == "integer" || fs.Type == "number") {
+			fs = &Schema{Type: "string"}
+		}
+		schema.Properties[name] = fs
+		if !optional {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+
+	// Fields of embedded structs are promoted unless shadowed by shallower ones
+	for _, et := range embedded {
+		s.fields(schema, et)
+	}
+}
@@ -0,0 +1,53 @@
+package device
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/acoderup/boost/message"
+)
+
+// stream sends the responses of a streaming handler, every response is marked with its
+// sequence number under message.MetadataStream. The final response without the mark
+// ends the stream.
+type stream struct {
+	handler *Handler
+	reqMsg  *message.Message
+	seq     uint64
+}
+
+func (s *stream) send(ctx context.Context, resp interface{}) error {
+	respMsg, err := reply(s.reqMsg, resp)
+	if err != nil {
+		return err
+	}
+	respMsg.Metadata.Set(message.MetadataStream, strconv.FormatUint(atomic.AddUint64(&s.seq, 1), 10))
+	return s.handler.Process(ctx, respMsg)
+}
+
+func (s *stream) drain(ctx context.Context, ch reflect.Value) error {
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: ch},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+	}
+	for {
+		chosen, resp, ok := reflect.Select(cases)
+		if chosen == 1 {
+			return ctx.Err()
+		}
+		if !ok {
+			return nil
+		}
+		if err := s.send(ctx, resp.Interface()); err != nil {
+			return err
+		}
+	}
+}
+
+// Streaming reports whether msg is a response of a stream with more to come.
+func Streaming(msg *message.Message) bool {
+	_, ok := msg.Metadata[message.MetadataStream]
+	return ok
+}
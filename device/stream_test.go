@@ -0,0 +1,187 @@
+package device_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/acoderup/boost/device"
+	"github.com/acoderup/boost/encoding"
+	"github.com/acoderup/boost/message"
+	"github.com/acoderup/boost/route"
+	"github.com/acoderup/boost/style"
+)
+
+type Match struct {
+	notified []string
+	callers  [][]string
+}
+
+func (m *Match) Notify(_ context.Context, req *Ping) error {
+	if req.Text == "" {
+		return errors.New("empty text")
+	}
+	m.notified = append(m.notified, req.Text)
+	return nil
+}
+
+func (m *Match) Progress(_ context.Context, req *Ping, send func(*Pong) error) error {
+	for _, text := range []string{"1", "2", "3"} {
+		if err := send(&Pong{Text: req.Text + text}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Match) Ticks(_ context.Context, req *Ping) (<-chan *Pong, error) {
+	ch := make(chan *Pong, 2)
+	ch <- &Pong{Text: req.Text}
+	ch <- &Pong{Text: req.Text}
+	close(ch)
+	return ch, nil
+}
+
+func (m *Match) Subscribe(ctx context.Context, _ *Ping) (*Pong, error) {
+	m.callers = append(m.callers, device.CallerFrom(ctx))
+	return &Pong{Text: "subscribed"}, nil
+}
+
+func newMatchMessage(client *device.Client, path, text string) *message.Message {
+	return &message.Message{
+		Route:    route.NewChainRoute(device.Addr(client), style.GoogleChain(path)),
+		Encoding: e1,
+		Data:     encoding.Encode(e1, &Ping{Text: text}),
+	}
+}
+
+func collect(t *testing.T, client *device.Client, path string) []string {
+	t.Helper()
+	var texts []string
+	ended := false
+	err := client.Invoke(context.Background(), newMatchMessage(client, path, "p"), device.NewFuncProcessor(func(_ context.Context, msg *message.Message) error {
+		if !device.Streaming(msg) {
+			ended = true
+			return nil
+		}
+		pong := &Pong{}
+		encoding.Decode(e1, msg.Data, pong)
+		texts = append(texts, pong.Text)
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !ended {
+		t.Fatalf("expecting stream %s to be ended", path)
+	}
+	return texts
+}
+
+func TestHandlerModes(t *testing.T) {
+	match := &Match{}
+	var pushed []*message.Message
+	client := device.NewClient("Anonymous").Fallback(device.NewFuncProcessor(func(_ context.Context, msg *message.Message) error {
+		pushed = append(pushed, msg)
+		return nil
+	}))
+	router := device.NewRouter("Match").Integrate(match)
+	device.NewBus().Integrate(client, router)
+
+	if err := client.Send(context.Background(), newMatchMessage(client, "/match/notify", "goal")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(match.notified) != 1 || match.notified[0] != "goal" {
+		t.Fatalf("unexpected notified %v", match.notified)
+	}
+	if err := client.Send(context.Background(), newMatchMessage(client, "/match/notify", "")); err == nil {
+		t.Fatal("expecting one-way error to be returned")
+	}
+
+	if texts := collect(t, client, "/match/progress"); len(texts) != 3 || texts[2] != "p3" {
+		t.Fatalf("unexpected stream %v", texts)
+	}
+	if texts := collect(t, client, "/match/ticks"); len(texts) != 2 || texts[0] != "p" {
+		t.Fatalf("unexpected stream %v", texts)
+	}
+	if stats := client.Stats(); stats.Outstanding != 0 || stats.Completed != 2 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	collect(t, client, "/match/subscribe")
+	if len(match.callers) != 1 {
+		t.Fatalf("unexpected callers %v", match.callers)
+	}
+	if err := device.Push(context.Background(), router, match.callers[0], e1, &Pong{Text: "score"}, nil); err != nil {
+		t.Fatalf("unexpected error pushing: %v", err)
+	}
+	if len(pushed) != 1 {
+		t.Fatalf("unexpected pushed %v", pushed)
+	}
+	pong := &Pong{}
+	encoding.Decode(e1, pushed[0].Data, pong)
+	if pushed[0].ID != 0 || pong.Text != "score" {
+		t.Fatalf("unexpected pushed %d %+v", pushed[0].ID, pong)
+	}
+}
+
+func TestStreamTransport(t *testing.T) {
+	listener := device.NewListener("Listener", nil)
+	device.NewBus().Integrate(device.NewRouter("Match").Integrate(&Match{}), listener)
+	defer listener.Close()
+
+	var lost atomic.Int32
+	client := device.NewClient("Anonymous").Fallback(device.NewFuncProcessor(func(context.Context, *message.Message) error {
+		lost.Add(1)
+		return nil
+	}))
+	dialer := device.NewDialerFunc("Match", func(context.Context) (net.Conn, error) {
+		local, remote := net.Pipe()
+		go listener.ServeConn(remote)
+		return local, nil
+	}).Announce(client.String())
+	device.NewBus().Integrate(client, dialer)
+	defer dialer.Close()
+
+	// Responses of a stream cross the connection in order, so none comes after the end
+	for index := 0; index < 20; index++ {
+		texts := make(chan string, 4)
+		err := client.Invoke(context.Background(), newMatchMessage(client, "/match/progress", "p"), device.NewFuncProcessor(func(_ context.Context, msg *message.Message) error {
+			if !device.Streaming(msg) {
+				close(texts)
+				return nil
+			}
+			pong := &Pong{}
+			encoding.Decode(e1, msg.Data, pong)
+			texts <- pong.Text
+			return nil
+		}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var got []string
+		timeout := time.After(10 * time.Second)
+	collect:
+		for {
+			select {
+			case text, ok := <-texts:
+				if !ok {
+					break collect
+				}
+				got = append(got, text)
+			case <-timeout:
+				t.Fatal("timeout when waiting for the stream to end")
+			}
+		}
+		if strings.Join(got, ",") != "p1,p2,p3" {
+			t.Fatalf("unexpected stream %v", got)
+		}
+	}
+	if n := lost.Load(); n != 0 {
+		t.Fatalf("expecting no response to fall back, got %d", n)
+	}
+}
@@ -0,0 +1,211 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/acoderup/boost/message"
+	"github.com/acoderup/boost/route"
+	"github.com/acoderup/boost/safe"
+)
+
+var (
+	ErrTopicUndelivered = errors.New("topic message is not acknowledged by every subscriber")
+)
+
+// Delivery is the guarantee of a published message.
+type Delivery int
+
+const (
+	// AtMostOnce processes the message once by every subscriber, failures are dropped.
+	AtMostOnce Delivery = iota
+	// Acknowledged retries subscribers which fail to process the message, and reports
+	// the ones which never do.
+	Acknowledged
+)
+
+type PublishOption func(*PublishOptions)
+
+type PublishOptions struct {
+	Delivery Delivery
+	Attempts int
+}
+
+var defaultPublishOptions = PublishOptions{
+	Delivery: AtMostOnce,
+	Attempts: 3,
+}
+
+func WithDelivery(delivery Delivery) PublishOption {
+	return func(o *PublishOptions) {
+		o.Delivery = delivery
+	}
+}
+
+// WithAttempts sets how many times an acknowledged message is tried per subscriber.
+func WithAttempts(attempts int) PublishOption {
+	return func(o *PublishOptions) {
+		o.Attempts = attempts
+	}
+}
+
+type subscription struct {
+	device Device
+	group  string
+}
+
+// Subscribe subscribes devices to topic.
+func (r *Router) Subscribe(topic string, devices ...Device) *Router {
+	for _, device := range devices {
+		r.subscribe(topic, subscription{device: device})
+	}
+	return r
+}
+
+// SubscribeGroup subscribes every device in the groups called names, the groups are
+// looked up when publishing, so devices extended later receive messages as well.
+func (r *Router) SubscribeGroup(topic string, names ...string) *Router {
+	for _, name := range names {
+		r.subscribe(topic, subscription{group: name})
+	}
+	return r
+}
+
+func (r *Router) Unsubscribe(topic string, devices ...Device) *Router {
+	for _, device := range devices {
+		r.unsubscribe(topic, subscription{device: device})
+	}
+	return r
+}
+
+func (r *Router) UnsubscribeGroup(topic string, names ...string) *Router {
+	for _, name := range names {
+		r.unsubscribe(topic, subscription{group: name})
+	}
+	return r
+}
+
+func (r *Router) subscribe(topic string, s subscription) {
+	r.rwMutex.Lock()
+	defer r.rwMutex.Unlock()
+
+	if r.topics == nil {
+		r.topics = make(map[string][]subscription)
+	}
+	for _, sub := range r.topics[topic] {
+		if sub == s {
+			return
+		}
+	}
+	r.topics[topic] = append(r.topics[topic], s)
+}
+
+func (r *Router) unsubscribe(topic string, s subscription) {
+	r.rwMutex.Lock()
+	defer r.rwMutex.Unlock()
+
+	subs := r.topics[topic]
+	for index, sub := range subs {
+		if sub == s {
+			subs = append(subs[:index:index], subs[index+1:]...)
+			break
+		}
+	}
+	if len(subs) == 0 {
+		delete(r.topics, topic)
+	} else {
+		r.topics[topic] = subs
+	}
+}
+
+// Subscribers returns the devices a message published to topic fans out to.
+func (r *Router) Subscribers(topic string) []Device {
+	r.rwMutex.RLock()
+	defer r.rwMutex.RUnlock()
+
+	var devices []Device
+	seen := make(map[Device]struct{})
+	add := func(device Device) {
+		if _, ok := seen[device]; !ok {
+			seen[device] = struct{}{}
+			devices = append(devices, device)
+		}
+	}
+	for _, sub := range r.topics[topic] {
+		if sub.device != nil {
+			add(sub.device)
+			continue
+		}
+		for _, device := range r.devices[sub.group] {
+			add(device)
+		}
+	}
+	return devices
+}
+
+// Publish fans msg out to every subscriber of topic. The route of msg is optional, its
+// source is where subscribers reply to, replies are dropped without it, and its
+// destination is the path of the handler under every subscriber, such as ["Event"]
+// when subscribers are routers.
+func (r *Router) Publish(ctx context.Context, topic string, msg *message.Message, opts ...PublishOption) error {
+	options := defaultPublishOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	attempts := 1
+	if options.Delivery == Acknowledged && options.Attempts > 1 {
+		attempts = options.Attempts
+	}
+
+	var src, path []string
+	if a, ok := msg.Route.(addressed); ok {
+		src, path = a.Src(), a.Dst()
+		// Path routes are absolute, their paths start under the root
+		if len(path) > 0 && path[0] == "" {
+			path = path[1:]
+		}
+	}
+	// Without a source nobody waits for replies, which are dropped
+	discard := len(src) == 0
+	if discard {
+		src = Addr(r)
+	}
+
+	var errs []error
+	for _, device := range r.Subscribers(topic) {
+		addr := Addr(device)
+		dst := append(addr[:len(addr):len(addr)], path...)
+		var err error
+		for attempt := 0; attempt < attempts; attempt++ {
+			m := &message.Message{
+				ID:       msg.ID,
+				Route:    route.MakeChainRoute(src, dst, len(addr)-1),
+				Encoding: msg.Encoding,
+				Metadata: msg.Metadata.Clone(),
+				Data:     msg.Data,
+			}
+			// Handlers reply with their errors, which the outcome catches, while the
+			// reply failing to be routed does not fail the delivery
+			o := &outcome{discard: discard}
+			err = safe.Do(func() error {
+				return device.Process(context.WithValue(ctx, outcomeKey{}, o), m)
+			})
+			if o.handled {
+				err = o.err
+			}
+			if err == nil || ctx.Err() != nil {
+				break
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", strings.Join(dst[1:], "/"), err))
+		}
+	}
+
+	if options.Delivery == Acknowledged && len(errs) > 0 {
+		return fmt.Errorf("%w: %w", ErrTopicUndelivered, errors.Join(errs...))
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package device_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/acoderup/boost/device"
+	"github.com/acoderup/boost/encoding"
+	"github.com/acoderup/boost/message"
+	"github.com/acoderup/boost/route"
+)
+
+type Room struct {
+	events *int32
+	fails  int32
+}
+
+func (r *Room) Event(_ context.Context, req *Ping) error {
+	if atomic.AddInt32(&r.fails, -1) >= 0 {
+		return errors.New("room is busy")
+	}
+	atomic.AddInt32(r.events, 1)
+	return nil
+}
+
+// Ledger is a request/response subscriber, its failures come back as error replies.
+type Ledger struct {
+	events int32
+	fails  int32
+}
+
+func (l *Ledger) Event(_ context.Context, req *Ping) (*Pong, error) {
+	if atomic.AddInt32(&l.fails, -1) >= 0 {
+		return nil, errors.New("ledger is busy")
+	}
+	atomic.AddInt32(&l.events, 1)
+	return &Pong{Text: req.Text}, nil
+}
+
+func newWorldEvent() *message.Message {
+	return &message.Message{
+		Route:    route.NewChainRoute(nil, []string{"Event"}),
+		Encoding: e1,
+		Data:     encoding.Encode(e1, &Ping{Text: "night"}),
+	}
+}
+
+func TestTopic(t *testing.T) {
+	var events int32
+	bus := device.NewBus()
+	for index := 0; index < 3; index++ {
+		bus.Integrate(device.NewRouter("Room").Integrate(&Room{events: &events}))
+	}
+	bus.SubscribeGroup("world", "Room")
+	if n := len(bus.Subscribers("world")); n != 3 {
+		t.Fatalf("expecting 3 subscribers, got %d", n)
+	}
+
+	if err := bus.Publish(context.Background(), "world", newWorldEvent()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if events != 3 {
+		t.Fatalf("expecting every room to get the event, got %d", events)
+	}
+
+	busy := device.NewRouter("Room").Integrate(&Room{events: &events, fails: 2})
+	bus.Integrate(busy)
+	events = 0
+	if err := bus.Publish(context.Background(), "world", newWorldEvent()); err != nil {
+		t.Fatalf("expecting failures dropped at most once, got %v", err)
+	}
+	if events != 3 {
+		t.Fatalf("expecting the busy room to miss the event, got %d", events)
+	}
+
+	events = 0
+	if err := bus.Publish(context.Background(), "world", newWorldEvent(), device.WithDelivery(device.Acknowledged)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if events != 4 {
+		t.Fatalf("expecting the busy room to be retried, got %d", events)
+	}
+
+	bus.Integrate(device.NewRouter("Room").Integrate(&Room{events: &events, fails: 5}))
+	err := bus.Publish(context.Background(), "world", newWorldEvent(), device.WithDelivery(device.Acknowledged), device.WithAttempts(2))
+	if !errors.Is(err, device.ErrTopicUndelivered) {
+		t.Fatalf("expecting undelivered error, got %v", err)
+	}
+
+	p, _ := route.NewPathRoute(nil, "/event")
+	events = 0
+	if err := bus.Publish(context.Background(), "world", &message.Message{Route: *p, Encoding: e1, Data: []byte(`{"text":"dawn"}`)}); err != nil {
+		t.Fatalf("unexpected error publishing along a path: %v", err)
+	}
+	if events != 4 {
+		t.Fatalf("expecting the healthy rooms to get the event along a path, got %d", events)
+	}
+
+	bus.UnsubscribeGroup("world", "Room").Subscribe("world", busy)
+	if n := len(bus.Subscribers("world")); n != 1 {
+		t.Fatalf("expecting 1 subscriber, got %d", n)
+	}
+}
+
+func TestTopicUnary(t *testing.T) {
+	ledger := &Ledger{fails: 1}
+	letters := device.NewDeadLetters(8)
+	bus := device.NewBus().Integrate(device.NewRouter("Ledger").Integrate(ledger)).DeadLetters(letters)
+	bus.SubscribeGroup("world", "Ledger")
+
+	if err := bus.Publish(context.Background(), "world", newWorldEvent(), device.WithDelivery(device.Acknowledged)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ledger.events != 1 {
+		t.Fatalf("expecting the failed request to be retried, got %d events", ledger.events)
+	}
+
+	ledger.fails = 5
+	err := bus.Publish(context.Background(), "world", newWorldEvent(), device.WithDelivery(device.Acknowledged), device.WithAttempts(2))
+	if !errors.Is(err, device.ErrTopicUndelivered) {
+		t.Fatalf("expecting undelivered error, got %v", err)
+	}
+	if ledger.fails != 3 {
+		t.Fatalf("expecting 2 attempts, got %d", 5-ledger.fails)
+	}
+
+	// Nobody waits for the replies of a message published without a source
+	if n := letters.Len(); n != 0 {
+		t.Fatalf("expecting replies to be dropped, got %d dead letters", n)
+	}
+}
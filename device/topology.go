@@ -0,0 +1,151 @@
+package device
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/acoderup/boost/metrics"
+)
+
+// Node is a device in the topology of a device tree.
+type Node struct {
+	Name     string      `json:"name"`
+	Path     string      `json:"path"`
+	Kind     string      `json:"kind"`
+	Type     string      `json:"type"`
+	Version  string      `json:"version,omitempty"`
+	Guarded  bool        `json:"guarded,omitempty"`
+	Handler  *HandlerDoc `json:"handler,omitempty"`
+	Counters *Counters   `json:"counters,omitempty"`
+	Children []*Node     `json:"children,omitempty"`
+}
+
+// HandlerDoc describes the function of a handler.
+type HandlerDoc struct {
+	Signature string `json:"signature"`
+	Mode      string `json:"mode"`
+	Request   string `json:"request"`
+	Response  string `json:"response,omitempty"`
+}
+
+// Counters are the metrics recorded for a device by the Metrics observer.
+type Counters struct {
+	Requests float64 `json:"requests"`
+	Errors   float64 `json:"errors"`
+	Inflight float64 `json:"inflight"`
+}
+
+// Topology returns the device tree under d, children are sorted by name. Counters
+// are read from r when it is not nil.
+func Topology(d Device, r *metrics.Registry) *Node {
+	node := &Node{
+		Name: d.String(),
+		Path: RoutePath(d),
+	}
+	node.Version = deviceVersion(d)
+	if g, ok := d.(*guarded); ok {
+		node.Guarded = true
+		d = g.Unwrap()
+	}
+	if v, ok := d.(*versioned); ok {
+		d = v.Unwrap()
+	}
+	node.Type = fmt.Sprintf("%T", d)
+	node.Kind = hopKind(d)
+
+	switch d := d.(type) {
+	case *Router:
+		if d.IsBus() {
+			node.Kind = "bus"
+		}
+	case *Client:
+		node.Kind = "client"
+	case *Handler:
+		req, resp := d.Types()
+		node.Handler = &HandlerDoc{
+			Signature: d.Signature(),
+			Mode:      d.Mode(),
+			Request:   typeName(req),
+			Response:  typeName(resp),
+		}
+	}
+	if kind := hopKind(d); r != nil && kind != "device" {
+		// Metrics are only read, so a registry not observed leaves counters out
+		if requests, ok := r.Value(metricRequests, node.Path, kind); ok {
+			errors, _ := r.Value(metricErrors, node.Path, kind)
+			inflight, _ := r.Value(metricInflight, node.Path, kind)
+			node.Counters = &Counters{
+				Requests: requests,
+				Errors:   errors,
+				Inflight: inflight,
+			}
+		}
+	}
+
+	for _, child := range children(d) {
+		node.Children = append(node.Children, Topology(child, r))
+	}
+	return node
+}
+
+// children returns the devices under d sorted by name.
+func children(d Device) []Device {
+	groups := d.Devices()
+	if s, ok := unwrap(d).(interface{ snapshot() map[string][]Device }); ok {
+		groups = s.snapshot()
+	}
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var devices []Device
+	for _, name := range names {
+		devices = append(devices, groups[name]...)
+	}
+	return devices
+}
+
+func typeName(t interface{ String() string }) string {
+	if t == nil {
+		return ""
+	}
+	return t.String()
+}
+
+// WriteDOT renders the topology in the Graphviz DOT language.
+func (n *Node) WriteDOT(w io.Writer) error {
+	var builder strings.Builder
+	builder.WriteString("digraph topology {\n\tnode [shape=box];\n")
+	var id int
+	var walk func(node *Node) int
+	walk = func(node *Node) int {
+		self := id
+		id++
+		label := node.Name + `\n` + node.Type
+		if node.Handler != nil {
+			label += `\n` + node.Handler.Signature
+		}
+		shape := "box"
+		if node.Kind == "handler" {
+			shape = "ellipse"
+		}
+		fmt.Fprintf(&builder, "\tn%d [label=\"%s\", shape=%s];\n", self, escapeDOT(label), shape)
+		for _, child := range node.Children {
+			fmt.Fprintf(&builder, "\tn%d -> n%d;\n", self, walk(child))
+		}
+		return self
+	}
+	walk(n)
+	builder.WriteString("}\n")
+
+	_, err := io.WriteString(w, builder.String())
+	return err
+}
+
+func escapeDOT(s string) string {
+	return strings.ReplaceAll(s, `"`, `\"`)
+}
@@ -0,0 +1,137 @@
+package device_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/acoderup/boost/device"
+	"github.com/acoderup/boost/metrics"
+)
+
+func findNode(node *device.Node, path string) *device.Node {
+	if node.Path == path {
+		return node
+	}
+	for _, child := range node.Children {
+		if n := findNode(child, path); n != nil {
+			return n
+		}
+	}
+	return nil
+}
+
+func TestTopology(t *testing.T) {
+	r := metrics.NewRegistry()
+	defer device.Observe(device.Metrics(r))()
+
+	client := device.NewClient("Anonymous")
+	router := device.NewRouter("Mapped").Integrate(&Flaky{})
+	router.Guard("Call", device.NewConcurrencyLimiter(1))
+	bus := device.NewBus().Integrate(client, device.NewRouter("Game").Integrate(router))
+	for index := 0; index < 2; index++ {
+		invokeTyped(t, client, "/game/mapped/call", e1, []byte(`{}`))
+	}
+
+	root := device.Topology(bus, r)
+	if root.Kind != "bus" {
+		t.Fatalf("expecting bus kind, got %q", root.Kind)
+	}
+	call := findNode(root, "/Game/Mapped/Call")
+	if call == nil {
+		t.Fatal("expecting handler node")
+	}
+	if !call.Guarded || call.Kind != "handler" || call.Handler == nil {
+		t.Fatalf("unexpected handler node %+v", call)
+	}
+	if call.Handler.Request != "*device_test.Ping" || call.Handler.Response != "*device_test.Pong" || call.Handler.Mode != "unary" {
+		t.Fatalf("unexpected handler doc %+v", call.Handler)
+	}
+	if call.Counters == nil || call.Counters.Requests != 2 || call.Counters.Errors != 0 {
+		t.Fatalf("unexpected counters %+v", call.Counters)
+	}
+	if n := findNode(root, "/Anonymous"); n == nil || n.Kind != "client" {
+		t.Fatalf("unexpected client node %+v", n)
+	}
+
+	var buf bytes.Buffer
+	if err := root.WriteDOT(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(buf.String(), "digraph") || !strings.Contains(buf.String(), "->") {
+		t.Fatalf("unexpected DOT:\n%s", buf.String())
+	}
+}
+
+func TestTopologyConflict(t *testing.T) {
+	r := metrics.NewRegistry()
+	r.Gauge("boost_device_requests_total", "")
+	bus := device.NewBus().Integrate(device.NewRouter("Game").Integrate(&Flaky{}))
+	if call := findNode(device.Topology(bus, r), "/Game/Call"); call == nil || call.Counters != nil {
+		t.Fatalf("expecting handler without counters, got %+v", call)
+	}
+}
+
+func TestAdmin(t *testing.T) {
+	r := metrics.NewRegistry()
+	bus := device.NewBus().Integrate(device.NewRouter("Game").Integrate(&Flaky{}))
+	server := httptest.NewServer(http.StripPrefix("/debug", device.NewAdmin(bus, r)))
+	defer server.Close()
+
+	get := func(path string) (*http.Response, string) {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer resp.Body.Close()
+		var buf bytes.Buffer
+		buf.ReadFrom(resp.Body)
+		return resp, buf.String()
+	}
+
+	resp, body := get("/debug/topology")
+	node := &device.Node{}
+	if err := json.Unmarshal([]byte(body), node); err != nil || resp.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected topology %q: %v", body, err)
+	}
+	if call := findNode(node, "/Game/Call"); call == nil || call.Counters != nil {
+		t.Fatalf("expecting handler without counters in topology %s", body)
+	}
+	if _, body = get("/debug/metrics"); body != "" {
+		t.Fatalf("expecting nothing registered by the topology, got %s", body)
+	}
+	if _, body = get("/debug/topology.dot"); !strings.Contains(body, "device_test.Ping") {
+		t.Fatalf("unexpected DOT %s", body)
+	}
+	if _, body = get("/debug/tree"); body != device.Tree(bus) {
+		t.Fatalf("unexpected tree %s", body)
+	}
+	if resp, _ = get("/debug/unknown"); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expecting 404, got %d", resp.StatusCode)
+	}
+}
+
+func TestTreeConcurrent(t *testing.T) {
+	game := device.NewRouter("Game")
+	bus := device.NewBus().Integrate(game)
+
+	// The tree is read while devices join, the race detector watches the groups
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for index := 0; index < 100; index++ {
+			game.Integrate(device.NewRouter(fmt.Sprint("Room", index)))
+		}
+	}()
+	for index := 0; index < 100; index++ {
+		device.Tree(bus)
+	}
+	<-done
+	if tree := device.Tree(bus); !strings.Contains(tree, "Room99") {
+		t.Fatalf("unexpected tree\n%s", tree)
+	}
+}
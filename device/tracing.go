@@ -0,0 +1,50 @@
+package device
+
+import (
+	"context"
+
+	"github.com/acoderup/boost/message"
+	"github.com/acoderup/boost/tracing"
+)
+
+type tracingObserver struct {
+	tracer *tracing.Tracer
+}
+
+// Tracing records a span for every hop with t, see Trace.
+//
+//	device.Observe(device.Tracing(tracing.NewTracer(tracing.NewMemoryExporter())))
+func Tracing(t *tracing.Tracer) Observer {
+	return &tracingObserver{tracer: t}
+}
+
+func (o *tracingObserver) Observe(ctx context.Context, hop Device, msg *message.Message) (context.Context, func(error)) {
+	return Trace(ctx, o.tracer, RoutePath(hop), hopKind(hop), msg)
+}
+
+// Trace starts a span of msg as a child of the span in ctx, or of the span carried by
+// msg when it comes from another process. The trace ID and span ID are carried with
+// msg as metadata, set on a copy so maps shared with other messages are left alone,
+// the returned function ends the span.
+func Trace(ctx context.Context, t *tracing.Tracer, name, kind string, msg *message.Message) (context.Context, func(error)) {
+	traceID, parentID := msg.Metadata.Get(message.MetadataTraceID), msg.Metadata.Get(message.MetadataSpanID)
+	if parent := tracing.SpanFrom(ctx); parent != nil && (traceID == "" || traceID == parent.TraceID) {
+		traceID, parentID = parent.TraceID, parent.SpanID
+	}
+
+	span := t.Start(traceID, parentID, name, kind)
+	if msg.Route != nil {
+		span.Route = msg.Route.String()
+	}
+	if msg.Encoding != nil {
+		span.Encoding = msg.Encoding.String()
+	}
+	md := msg.Metadata.Clone()
+	md.Set(message.MetadataTraceID, span.TraceID)
+	md.Set(message.MetadataSpanID, span.SpanID)
+	msg.Metadata = md
+
+	return tracing.ContextWithSpan(ctx, span), func(err error) {
+		t.End(span, err)
+	}
+}
@@ -0,0 +1,26 @@
+package device_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/acoderup/boost/device"
+	"github.com/acoderup/boost/message"
+	"github.com/acoderup/boost/tracing"
+)
+
+func TestTraceMetadata(t *testing.T) {
+	tracer := tracing.NewTracer(tracing.NewMemoryExporter())
+	md := message.Metadata{message.MetadataTraceID: "trace-1"}
+	first, second := &message.Message{Metadata: md}, &message.Message{Metadata: md}
+
+	// Messages sharing metadata, such as published ones, keep their own spans
+	_, end := device.Trace(context.Background(), tracer, "first", "handler", first)
+	end(nil)
+	if first.Metadata.Get(message.MetadataSpanID) == "" || first.Metadata.Get(message.MetadataTraceID) != "trace-1" {
+		t.Fatalf("unexpected metadata %v", first.Metadata)
+	}
+	if _, ok := second.Metadata[message.MetadataSpanID]; ok {
+		t.Fatalf("expecting shared metadata untouched, got %v", second.Metadata)
+	}
+}
@@ -0,0 +1,288 @@
+package device_test
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/acoderup/boost/device"
+	"github.com/acoderup/boost/encoding"
+	"github.com/acoderup/boost/magic"
+	"github.com/acoderup/boost/message"
+	"github.com/acoderup/boost/route"
+	"github.com/acoderup/boost/style"
+)
+
+func newTransportServer(t *testing.T) (*device.Listener, chan string) {
+	logChan := make(chan string, 64)
+	try := &Try{logChan}
+	router := device.NewRouter(magic.Server).Integrate(try)
+	listener, err := device.Listen("Listener", "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error listening: %v", err)
+	}
+	device.NewBus().Integrate(router, listener)
+	go listener.Serve()
+	t.Cleanup(func() { listener.Close() })
+	return listener, logChan
+}
+
+func invokeEcho(ctx context.Context, client *device.Client, text string) (string, error) {
+	reqData, err := encoding.Marshal(e1, &Ping{Text: text})
+	if err != nil {
+		return "", err
+	}
+	msg := &message.Message{
+		Route:    route.NewChainRoute(device.Addr(client), style.GoogleChain("/server/echo")),
+		Encoding: e1,
+		Data:     reqData,
+	}
+
+	respChan := make(chan string, 1)
+	processor := device.NewFuncProcessor(func(_ context.Context, msg *message.Message) error {
+		resp := &Pong{}
+		if err := e1.Unmarshal(msg.Data, resp); err != nil {
+			return err
+		}
+		respChan <- resp.Text
+		return nil
+	})
+	if err = client.Invoke(ctx, msg, processor); err != nil {
+		return "", err
+	}
+
+	select {
+	case text := <-respChan:
+		return text, nil
+	case <-time.After(10 * time.Second):
+		return "", fmt.Errorf("timeout when waiting for %q", text)
+	}
+}
+
+func TestTransportTCP(t *testing.T) {
+	listener, _ := newTransportServer(t)
+
+	client := device.NewClient("Anonymous")
+	dialer := device.NewDialer(magic.Server, "tcp", listener.Addr().String()).Announce(client.String())
+	device.NewBus().Integrate(client, dialer)
+	defer dialer.Close()
+
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for index := 0; index < 16; index++ {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			text := fmt.Sprintf("libra: Hello, world %d!", index)
+			resp, err := invokeEcho(ctx, client, text)
+			if err != nil {
+				t.Errorf("unexpected error invoking: %v", err)
+				return
+			}
+			if resp != text {
+				t.Errorf("expecting %q, got %q", text, resp)
+			}
+		}(index)
+	}
+	wg.Wait()
+
+	if n := dialer.Inflight(); n != 0 {
+		t.Fatalf("expecting no in-flight messages, got %d", n)
+	}
+}
+
+func TestTransportReconnect(t *testing.T) {
+	listener, _ := newTransportServer(t)
+
+	var mutex sync.Mutex
+	var conns []net.Conn
+	client := device.NewClient("Anonymous")
+	dialer := device.NewDialerFunc(magic.Server, func(ctx context.Context) (net.Conn, error) {
+		conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", listener.Addr().String())
+		if err == nil {
+			mutex.Lock()
+			conns = append(conns, conn)
+			mutex.Unlock()
+		}
+		return conn, err
+	}).Announce(client.String())
+	device.NewBus().Integrate(client, dialer)
+	defer dialer.Close()
+
+	ctx := context.Background()
+	if _, err := invokeEcho(ctx, client, "before"); err != nil {
+		t.Fatalf("unexpected error invoking: %v", err)
+	}
+
+	mutex.Lock()
+	conns[0].Close()
+	mutex.Unlock()
+	time.Sleep(10 * time.Millisecond)
+
+	resp, err := invokeEcho(ctx, client, "after")
+	if err != nil {
+		t.Fatalf("unexpected error invoking after reconnect: %v", err)
+	}
+	if resp != "after" {
+		t.Fatalf("expecting %q, got %q", "after", resp)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(conns) != 2 {
+		t.Fatalf("expecting 2 dials, got %d", len(conns))
+	}
+}
+
+func TestTransportPipe(t *testing.T) {
+	logChan := make(chan string, 64)
+	try := &Try{logChan}
+	router := device.NewRouter(magic.Server).Integrate(try)
+	listener := device.NewListener("Listener", nil)
+	device.NewBus().Integrate(router, listener)
+	defer listener.Close()
+
+	client := device.NewClient("Anonymous")
+	dialer := device.NewDialerFunc(magic.Server, func(context.Context) (net.Conn, error) {
+		local, remote := net.Pipe()
+		go listener.ServeConn(remote)
+		return local, nil
+	}).Announce(client.String())
+	device.NewBus().Integrate(client, dialer)
+	defer dialer.Close()
+
+	resp, err := invokeEcho(context.Background(), client, "pipe")
+	if err != nil {
+		t.Fatalf("unexpected error invoking: %v", err)
+	}
+	if resp != "pipe" {
+		t.Fatalf("expecting %q, got %q", "pipe", resp)
+	}
+}
+
+func hello(t *testing.T, listener *device.Listener, name string) (net.Conn, <-chan error) {
+	t.Helper()
+	local, remote := net.Pipe()
+	served := make(chan error, 1)
+	go func() {
+		served <- listener.ServeConn(remote)
+	}()
+	frame := binary.BigEndian.AppendUint32(nil, uint32(len(name)))
+	if _, err := local.Write(append(frame, name...)); err != nil {
+		t.Fatalf("unexpected error writing hello: %v", err)
+	}
+	return local, served
+}
+
+func TestListenerHandshake(t *testing.T) {
+	router := device.NewRouter(magic.Server)
+	listener := device.NewListener("Listener", nil)
+	bus := device.NewBus().Integrate(router, listener)
+	defer listener.Close()
+
+	for _, name := range []string{"", "a/b", "{peer}", "Peer 1"} {
+		_, served := hello(t, listener, name)
+		if err := <-served; !errors.Is(err, device.ErrHandshakeInvalid) {
+			t.Fatalf("expecting %q to be invalid, got %v", name, err)
+		}
+	}
+	_, served := hello(t, listener, magic.Server)
+	if err := <-served; !errors.Is(err, device.ErrHandshakeDuplicate) {
+		t.Fatalf("expecting the name of the router to be rejected, got %v", err)
+	}
+
+	waitMember := func(previous device.Device) device.Device {
+		for range 100 {
+			if members := bus.Members("Peer"); len(members) == 1 && members[0] != previous {
+				return members[0]
+			}
+			time.Sleep(time.Millisecond)
+		}
+		t.Fatalf("expecting a single connection of the peer, got %v", bus.Members("Peer"))
+		return nil
+	}
+	first, firstServed := hello(t, listener, "Peer")
+	defer first.Close()
+	previous := waitMember(nil)
+
+	// A peer announcing its name again replaces its previous connection
+	second, _ := hello(t, listener, "Peer")
+	defer second.Close()
+	waitMember(previous)
+	select {
+	case <-firstServed:
+	case <-time.After(time.Second):
+		t.Fatal("expecting the previous connection to be closed")
+	}
+	if members := bus.Members("Peer"); len(members) != 1 {
+		t.Fatalf("expecting a single connection of the peer, got %v", members)
+	}
+}
+
+func TestTransportDialer(t *testing.T) {
+	buff := &Buff{expired: make(chan string, 1)}
+	listener := device.NewListener("Listener", nil)
+	device.NewBus().Integrate(device.NewRouter(magic.Server).Integrate(buff), listener)
+	defer listener.Close()
+
+	dial := func(context.Context) (net.Conn, error) {
+		local, remote := net.Pipe()
+		go listener.ServeConn(remote)
+		return local, nil
+	}
+	msg := func(client *device.Client) *message.Message {
+		return &message.Message{
+			Route:    route.NewChainRoute(device.Addr(client), style.GoogleChain("/server/expire")),
+			Encoding: e1,
+			Data:     []byte(`{"Text":"once"}`),
+		}
+	}
+
+	// A dialer must announce the name replies are routed back to
+	client := device.NewClient("Anonymous")
+	anonymous := device.NewDialerFunc(magic.Server, dial)
+	device.NewBus().Integrate(client, anonymous)
+	if err := client.Send(context.Background(), msg(client)); !errors.Is(err, device.ErrDialerAnonymous) {
+		t.Fatalf("expecting anonymous dialer error, got %v", err)
+	}
+
+	// A one-way handler never replies, so its message stops counting once it expires
+	client = device.NewClient("Anonymous")
+	dialer := device.NewDialerFunc(magic.Server, dial).Announce(client.String())
+	device.NewBus().Integrate(client, dialer)
+	defer dialer.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := client.Invoke(ctx, msg(client), device.NewFuncProcessor(func(context.Context, *message.Message) error {
+		return nil
+	})); err != nil {
+		t.Fatalf("unexpected error invoking: %v", err)
+	}
+	expect(t, buff.expired, "once")
+	if n := dialer.Inflight(); n != 1 {
+		t.Fatalf("expecting the message in flight until it expires, got %d", n)
+	}
+	<-ctx.Done()
+	time.Sleep(time.Millisecond)
+	if n := dialer.Inflight(); n != 0 {
+		t.Fatalf("expecting the expired message not to count, got %d", n)
+	}
+}
+
+func TestConnWriteTimeout(t *testing.T) {
+	local, remote := net.Pipe()
+	defer remote.Close()
+	conn := device.NewConn("Peer", local).WriteTimeout(20 * time.Millisecond)
+
+	// The peer never reads, so the write times out instead of blocking
+	err := conn.Send(&message.Message{Route: route.NewChainRoute(nil, []string{"Peer"}), Data: []byte("stuck")})
+	var ne net.Error
+	if !errors.As(err, &ne) || !ne.Timeout() {
+		t.Fatalf("expecting a write timeout, got %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package device
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/acoderup/boost/message"
+)
+
+// Handle registers f under the router as the handler called name. Requests are decoded
+// into a new Req and f is called directly, without the reflection of Integrate.
+func Handle[Req, Resp any](r *Router, name string, f func(context.Context, *Req) (*Resp, error)) *Handler {
+	return handle(r, name, reflect.TypeOf(f), func(ctx context.Context, reqMsg *message.Message) (*message.Message, error) {
+		req := new(Req)
+		if err := decode(reqMsg, req); err != nil {
+			return nil, err
+		}
+		resp, err := f(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		if resp == nil {
+			return reply(reqMsg, nil)
+		}
+		return reply(reqMsg, resp)
+	})
+}
+
+// HandleValue is Handle for value, slice and interface types, which Integrate rejects.
+// The encoding decodes into a *Req, so an interface Req gets whatever the encoding
+// produces, such as a map[string]interface{} for JSON.
+func HandleValue[Req, Resp any](r *Router, name string, f func(context.Context, Req) (Resp, error)) *Handler {
+	return handle(r, name, reflect.TypeOf(f), func(ctx context.Context, reqMsg *message.Message) (*message.Message, error) {
+		var req Req
+		if err := decode(reqMsg, &req); err != nil {
+			return nil, err
+		}
+		resp, err := f(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		return reply(reqMsg, resp)
+	})
+}
+
+// handle registers a handler, the function type is only inspected for its signature.
+func handle(r *Router, name string, fn reflect.Type, call func(context.Context, *message.Message) (*message.Message, error)) *Handler {
+	h := &Handler{
+		Base: NewBase(),
+		name: name,
+		call: call,
+		fn:   fn,
+	}
+	r.Extend(h)
+	h.Join(r)
+	return h
+}
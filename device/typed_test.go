@@ -0,0 +1,106 @@
+package device_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/acoderup/boost/device"
+	"github.com/acoderup/boost/encoding"
+	"github.com/acoderup/boost/message"
+	"github.com/acoderup/boost/route"
+	"github.com/acoderup/boost/style"
+)
+
+func echo(_ context.Context, req *Ping) (*Pong, error) {
+	return &Pong{Text: req.Text}, nil
+}
+
+// Echoer registers echo by reflection, to compare it with the typed registration.
+type Echoer struct{}
+
+func (*Echoer) Echo(ctx context.Context, req *Ping) (*Pong, error) {
+	return echo(ctx, req)
+}
+
+func newTypedBus() (*device.Client, *device.Router) {
+	client := device.NewClient("Anonymous")
+	router := device.NewRouter("Typed")
+	device.Handle(router, "Echo", echo)
+	device.HandleValue(router, "Words", func(_ context.Context, req []string) (int, error) {
+		if len(req) == 0 {
+			return 0, errors.New("no words")
+		}
+		return len(req), nil
+	})
+	device.HandleValue(router, "Raw", func(_ context.Context, req []byte) ([]byte, error) {
+		return append(req, '!'), nil
+	})
+	device.NewBus().Integrate(client, router, device.NewRouter("Reflect").Integrate(&Echoer{}))
+	return client, router
+}
+
+func invokeTyped(b testing.TB, client *device.Client, path string, e encoding.Encoding, data []byte) *message.Message {
+	var resp *message.Message
+	err := client.Invoke(context.Background(), &message.Message{
+		Route:    route.NewChainRoute(device.Addr(client), style.GoogleChain(path)),
+		Encoding: e,
+		Data:     data,
+	}, device.NewFuncProcessor(func(_ context.Context, msg *message.Message) error {
+		resp = msg
+		return nil
+	}))
+	if err != nil {
+		b.Fatalf("unexpected error: %v", err)
+	}
+	return resp
+}
+
+func TestHandleTyped(t *testing.T) {
+	client, _ := newTypedBus()
+
+	for _, path := range []string{"/typed/echo", "/reflect/echo"} {
+		pong := &Pong{}
+		encoding.Decode(e1, invokeTyped(t, client, path, e1, encoding.Encode(e1, &Ping{Text: "typed"})).Data, pong)
+		if pong.Text != "typed" {
+			t.Fatalf("%s: unexpected response %+v", path, pong)
+		}
+	}
+
+	var n int
+	encoding.Decode(e1, invokeTyped(t, client, "/typed/words", e1, encoding.Encode(e1, []string{"a", "b"})).Data, &n)
+	if n != 2 {
+		t.Fatalf("expecting 2 words, got %d", n)
+	}
+
+	var e *device.Error
+	resp := invokeTyped(t, client, "/typed/words", e1, encoding.Encode(e1, []string{}))
+	if err := device.ErrorOf(resp); !errors.As(err, &e) || e.Message != "no words" {
+		t.Fatalf("expecting error reply, got %v", err)
+	}
+
+	lazy := encoding.NewLazy()
+	if resp := invokeTyped(t, client, "/typed/raw", lazy, []byte("raw")); string(resp.Data) != "raw!" {
+		t.Fatalf("unexpected response %q", resp.Data)
+	}
+}
+
+func BenchmarkHandlerReflect(b *testing.B) {
+	client, _ := newTypedBus()
+	data := encoding.Encode(e1, &Ping{Text: "bench"})
+	b.ReportAllocs()
+	b.ResetTimer()
+	for index := 0; index < b.N; index++ {
+		invokeTyped(b, client, "/reflect/echo", e1, data)
+	}
+}
+
+func BenchmarkHandlerTyped(b *testing.B) {
+	client, _ := newTypedBus()
+	data := encoding.Encode(e1, &Ping{Text: "bench"})
+	b.ReportAllocs()
+	b.ResetTimer()
+	for index := 0; index < b.N; index++ {
+		invokeTyped(b, client, "/typed/echo", e1, data)
+	}
+}
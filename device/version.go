@@ -0,0 +1,214 @@
+package device
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/acoderup/boost/message"
+	"github.com/acoderup/boost/stringx"
+)
+
+var (
+	ErrVersionNotFound   = errors.New("route cannot find a matching version")
+	ErrVersionConstraint = errors.New("version constraint is malformed")
+)
+
+// Versioned is implemented by devices serving a version of their group, messages pick
+// versions by the version metadata.
+type Versioned interface {
+	Version() string
+}
+
+type versioned struct {
+	Device
+	version string
+}
+
+func (v *versioned) Version() string {
+	return v.version
+}
+
+func (v *versioned) Key() string {
+	return deviceKey(v.Device)
+}
+
+// Unwrap returns the device serving the version.
+func (v *versioned) Unwrap() Device {
+	return v.Device
+}
+
+func deviceVersion(d Device) string {
+	for {
+		if v, ok := d.(Versioned); ok {
+			return v.Version()
+		}
+		u, ok := d.(interface{ Unwrap() Device })
+		if !ok {
+			return ""
+		}
+		d = u.Unwrap()
+	}
+}
+
+type comparator struct {
+	op      string
+	version string
+}
+
+// VersionConstraint selects the versions of a group, the latest of the matching
+// versions is picked. Constraints are compared with stringx.CompareVersion:
+//
+//	"" or "latest"  the latest version
+//	"1.2.0"         exactly 1.2.0, the same as "=1.2.0"
+//	"^1.2"          the latest compatible with 1.2, of major version 1 and not older
+//	">=1.0 <2.0"    a range, comparators are =, >, >=, < and <=
+type VersionConstraint struct {
+	major       string
+	comparators []comparator
+}
+
+func ParseVersionConstraint(s string) (VersionConstraint, error) {
+	var c VersionConstraint
+	s = strings.TrimSpace(s)
+	if s == "" || s == "latest" || s == "*" {
+		return c, nil
+	}
+
+	if version, ok := strings.CutPrefix(s, "^"); ok {
+		if !validVersion(version) {
+			return c, ErrVersionConstraint
+		}
+		c.major, _, _ = strings.Cut(version, ".")
+		c.comparators = []comparator{{op: ">=", version: version}}
+		return c, nil
+	}
+
+	for _, field := range strings.FieldsFunc(s, func(r rune) bool { return r == ' ' || r == ',' }) {
+		version := strings.TrimLeft(field, "<>=")
+		op := field[:len(field)-len(version)]
+		if op == "" {
+			op = "="
+		}
+		switch op {
+		case "=", ">", ">=", "<", "<=":
+		default:
+			return c, ErrVersionConstraint
+		}
+		if !validVersion(version) {
+			return c, ErrVersionConstraint
+		}
+		c.comparators = append(c.comparators, comparator{op: op, version: version})
+	}
+	return c, nil
+}
+
+func validVersion(version string) bool {
+	for _, part := range strings.Split(version, ".") {
+		if _, err := strconv.Atoi(part); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Match reports whether version satisfies the constraint.
+func (c VersionConstraint) Match(version string) bool {
+	if c.major != "" {
+		if major, _, _ := strings.Cut(version, "."); major != c.major {
+			return false
+		}
+	}
+	for _, cmp := range c.comparators {
+		n := stringx.CompareVersion(version, cmp.version)
+		var ok bool
+		switch cmp.op {
+		case "=":
+			ok = n == 0
+		case ">":
+			ok = n > 0
+		case ">=":
+			ok = n >= 0
+		case "<":
+			ok = n < 0
+		case "<=":
+			ok = n <= 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// matchVersions returns the devices of the latest version matching constraint, groups
+// without versions are returned as they are, since a version is carried by a message
+// along the whole route. Unversioned members of a mixed group serve the empty
+// constraint, which messages without a version and without a default carry.
+func matchVersions(devices []Device, constraint string) ([]Device, error) {
+	var plain []Device
+	for _, device := range devices {
+		if deviceVersion(device) == "" {
+			plain = append(plain, device)
+		}
+	}
+	if len(plain) == len(devices) {
+		return devices, nil
+	}
+	if constraint == "" && len(plain) > 0 {
+		return plain, nil
+	}
+
+	c, err := ParseVersionConstraint(constraint)
+	if err != nil {
+		return nil, err
+	}
+	var matched []Device
+	var latest string
+	for _, device := range devices {
+		version := deviceVersion(device)
+		if version == "" || !c.Match(version) {
+			continue
+		}
+		switch n := stringx.CompareVersion(version, latest); {
+		case len(matched) == 0 || n > 0:
+			matched = append(matched[:0], device)
+			latest = version
+		case n == 0:
+			matched = append(matched, device)
+		}
+	}
+	if len(matched) == 0 {
+		return nil, ErrVersionNotFound
+	}
+	return matched, nil
+}
+
+// Version integrates targets as the given version of their groups, see
+// VersionConstraint for how messages pick versions. Members integrated without a
+// version keep serving messages which ask for no version.
+func (r *Router) Version(version string, targetList ...interface{}) *Router {
+	for _, target := range targetList {
+		var devices []Device
+		if device, ok := target.(Device); ok {
+			devices = []Device{&versioned{Device: device, version: version}}
+		} else {
+			devices = extractHandlers(target)
+			for _, device := range devices {
+				device.(*Handler).version = version
+			}
+		}
+		for _, device := range devices {
+			r.Extend(device)
+			device.Join(r)
+		}
+	}
+	return r
+}
+
+func versionOf(msg *message.Message) string {
+	if msg == nil {
+		return ""
+	}
+	return msg.Metadata[message.MetadataVersion]
+}
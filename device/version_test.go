@@ -0,0 +1,171 @@
+package device_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/acoderup/boost/device"
+	"github.com/acoderup/boost/message"
+	"github.com/acoderup/boost/route"
+	"github.com/acoderup/boost/style"
+)
+
+type Quote struct {
+	Version string `json:"version"`
+}
+
+type PriceV1 struct{}
+
+func (*PriceV1) Quote(context.Context, *Ping) (*Quote, error) {
+	return &Quote{Version: "1.0.0"}, nil
+}
+
+type PriceV12 struct{}
+
+func (*PriceV12) Quote(context.Context, *Ping) (*Quote, error) {
+	return &Quote{Version: "1.2.0"}, nil
+}
+
+type PriceV2 struct{}
+
+func (*PriceV2) Quote(context.Context, *Ping) (*Quote, error) {
+	return &Quote{Version: "2.0.0"}, nil
+}
+
+func quote(t *testing.T, client *device.Client, version string) (string, error) {
+	t.Helper()
+	msg := &message.Message{
+		Route:    route.NewChainRoute(device.Addr(client), style.GoogleChain("/shop/quote")),
+		Encoding: e1,
+		Data:     []byte(`{}`),
+	}
+	if version != "" {
+		msg.Metadata.Set(message.MetadataVersion, version)
+	}
+
+	var resp *message.Message
+	if err := client.Invoke(context.Background(), msg, device.NewFuncProcessor(func(_ context.Context, m *message.Message) error {
+		resp = m
+		return nil
+	})); err != nil {
+		return "", err
+	}
+	if err := device.ErrorOf(resp); err != nil {
+		return "", err
+	}
+	q := &Quote{}
+	if err := e1.Unmarshal(resp.Data, q); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return q.Version, nil
+}
+
+func TestVersionConstraint(t *testing.T) {
+	cases := []struct {
+		constraint string
+		version    string
+		match      bool
+	}{
+		{"", "0.1", true},
+		{"1.2.0", "1.2.0", true},
+		{"=1.2.0", "1.2.1", false},
+		{"^1.2", "1.9.0", true},
+		{"^1.2", "1.1.9", false},
+		{"^1.2", "2.0.0", false},
+		{">=1.0 <2.0", "1.5", true},
+		{">=1.0, <2.0", "2.0", false},
+		{">1.0", "1.0", false},
+		{"<=1.0", "1.0", true},
+	}
+	for _, c := range cases {
+		vc, err := device.ParseVersionConstraint(c.constraint)
+		if err != nil {
+			t.Fatalf("unexpected error parsing %q: %v", c.constraint, err)
+		}
+		if vc.Match(c.version) != c.match {
+			t.Fatalf("expecting %q matching %q to be %v", c.constraint, c.version, c.match)
+		}
+	}
+
+	for _, constraint := range []string{"^", "~1.0", "1.x", "=>1.0"} {
+		if _, err := device.ParseVersionConstraint(constraint); err == nil {
+			t.Fatalf("expecting %q to be malformed", constraint)
+		}
+	}
+}
+
+func TestVersionRouting(t *testing.T) {
+	client := device.NewClient("Anonymous")
+	shop := device.NewRouter("Shop").
+		Version("1.0.0", &PriceV1{}).
+		Version("2.0.0", &PriceV2{}).
+		Version("1.2.0", &PriceV12{})
+	device.NewBus().Integrate(client, shop)
+
+	cases := []struct {
+		constraint string
+		version    string
+		code       device.ErrorCode
+	}{
+		{"", "2.0.0", 0},
+		{"1.0.0", "1.0.0", 0},
+		{"^1.0", "1.2.0", 0},
+		{">=1.0 <1.2", "1.0.0", 0},
+		{"3.0.0", "", device.CodeNotFound},
+		{"v1", "", device.CodeInvalidArgument},
+	}
+	for _, c := range cases {
+		version, err := quote(t, client, c.constraint)
+		if c.code != 0 {
+			if device.AsError(err).Code != c.code {
+				t.Fatalf("expecting %v for %q, got %v", c.code, c.constraint, err)
+			}
+			continue
+		}
+		if err != nil || version != c.version {
+			t.Fatalf("expecting version %s for %q, got %s: %v", c.version, c.constraint, version, err)
+		}
+	}
+
+	if err := shop.DefaultVersion("^1", "Quote"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if version, _ := quote(t, client, ""); version != "1.2.0" {
+		t.Fatalf("expecting default version 1.2.0, got %s", version)
+	}
+	if infos := shop.Handlers(); len(infos) != 3 || infos[2].Version != "2.0.0" {
+		t.Fatalf("unexpected handlers %+v", infos)
+	}
+}
+
+func TestVersionMixed(t *testing.T) {
+	client := device.NewClient("Anonymous")
+	shop := device.NewRouter("Shop").
+		Integrate(&PriceV1{}).
+		Version("2.0.0", &PriceV2{})
+	device.NewBus().Integrate(client, shop)
+
+	// The unversioned member keeps serving messages without a version
+	if version, err := quote(t, client, ""); err != nil || version != "1.0.0" {
+		t.Fatalf("expecting unversioned 1.0.0, got %s: %v", version, err)
+	}
+	if version, err := quote(t, client, "latest"); err != nil || version != "2.0.0" {
+		t.Fatalf("expecting latest 2.0.0, got %s: %v", version, err)
+	}
+
+	if err := shop.DefaultVersion("^2", "Quote"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if version, err := quote(t, client, ""); err != nil || version != "2.0.0" {
+		t.Fatalf("expecting default 2.0.0, got %s: %v", version, err)
+	}
+
+	// A malformed default is rejected and the previous one kept
+	if err := shop.DefaultVersion("v2", "Quote"); !errors.Is(err, device.ErrVersionConstraint) {
+		t.Fatalf("expecting malformed constraint error, got %v", err)
+	}
+	if version, err := quote(t, client, ""); err != nil || version != "2.0.0" {
+		t.Fatalf("expecting default 2.0.0 kept, got %s: %v", version, err)
+	}
+}
@@ -0,0 +1,133 @@
+package devicetest_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/acoderup/boost/device"
+	"github.com/acoderup/boost/devicetest"
+	"github.com/acoderup/boost/message"
+	"github.com/acoderup/boost/service"
+)
+
+type Counter struct {
+	total int
+}
+
+type Amount struct {
+	N int `json:"n"`
+}
+
+type Total struct {
+	Total int `json:"total"`
+}
+
+func (c *Counter) Add(_ context.Context, req *Amount) (*Total, error) {
+	if req.N < 0 {
+		return nil, errors.New("negative amount")
+	}
+	c.total += req.N
+	return &Total{Total: c.total}, nil
+}
+
+func (c *Counter) Count(_ context.Context, req *Amount, send func(*Total) error) error {
+	for index := 1; index <= req.N; index++ {
+		if err := send(&Total{Total: index}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func record(t *testing.T, s *service.Service) []devicetest.Record {
+	t.Helper()
+	recorder, err := devicetest.Attach(s.Router())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, req := range []string{`{"n":1}`, `{"n":2}`, `{"n":-1}`} {
+		s.Invoke("/add", req)
+	}
+	if resp := s.Invoke("/add", `{"n":3}`); resp != `{"total":6}` {
+		t.Fatalf("unexpected response through recorder %s", resp)
+	}
+	return recorder.Records()
+}
+
+func TestRecorder(t *testing.T) {
+	records := record(t, service.New(&Counter{}))
+	if len(records) != 8 {
+		t.Fatalf("expecting 4 requests and 4 replies, got %d records", len(records))
+	}
+	if records[0].Direction != devicetest.In || records[1].Direction != devicetest.Out || records[1].ID != records[0].ID {
+		t.Fatalf("unexpected records %+v", records[:2])
+	}
+	devicetest.Golden(t, "testdata/counter.golden", records)
+}
+
+func TestRecorderChain(t *testing.T) {
+	s := service.New(&Counter{})
+	var intercepted int
+	s.Router().Use(func(ctx context.Context, msg *message.Message, next device.Invoker) error {
+		intercepted++
+		return next(ctx, msg)
+	})
+	letters := device.NewDeadLetters(8)
+	s.Router().Gateway().(*device.Router).DeadLetters(letters)
+
+	// Recorded devices keep the interceptors and dead letters of the routers above
+	if _, err := devicetest.Attach(s.Router().Locate("Add")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	recorder, err := devicetest.Attach(s.Router())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp := s.Invoke("/add", `{"n":1}`); resp != `{"total":1}` || intercepted != 1 {
+		t.Fatalf("unexpected response %s intercepted %d times", resp, intercepted)
+	}
+	s.Invoke("/missing", `{}`)
+	if letters.Len() != 1 {
+		t.Fatalf("expecting a dead letter, got %d", letters.Len())
+	}
+	if n := len(recorder.Records()); n != 3 {
+		t.Fatalf("expecting 2 requests and a reply recorded, got %d", n)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	devicetest.ReplayGolden(t, service.New(&Counter{}), "testdata/counter.golden")
+
+	records, err := devicetest.LoadRecords("testdata/counter.golden")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	mismatches, err := devicetest.Replay(service.New(&Counter{total: 10}), records)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The failed request replies the same error
+	if len(mismatches) != 3 {
+		t.Fatalf("expecting 3 mismatches, got %v", mismatches)
+	}
+}
+
+func TestReplayStream(t *testing.T) {
+	s := service.New(&Counter{})
+	recorder, err := devicetest.Attach(s.Router())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s.Invoke("/count", `{"n":3}`)
+
+	records := recorder.Records()
+	if len(records) != 5 {
+		t.Fatalf("expecting a request, 3 replies and the end of stream, got %d records", len(records))
+	}
+	mismatches, err := devicetest.Replay(service.New(&Counter{}), records)
+	if err != nil || len(mismatches) != 0 {
+		t.Fatalf("unexpected mismatches %v: %v", mismatches, err)
+	}
+}
@@ -0,0 +1,147 @@
+package devicetest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/acoderup/boost/message"
+)
+
+var update = flag.Bool("update-golden", false, "write golden files instead of comparing with them")
+
+// Volatile are the metadata keys whose values change from run to run, they are left
+// out of golden files and replay comparisons.
+var Volatile = []string{
+	message.MetadataTraceID,
+	message.MetadataSpanID,
+	message.MetadataDeadline,
+}
+
+// Normalize renumbers message IDs in order of appearance and drops volatile metadata,
+// so recordings of different runs compare equal.
+func Normalize(records []Record) []Record {
+	ids := make(map[uint64]uint64)
+	normalized := make([]Record, len(records))
+	for index, record := range records {
+		if record.ID != 0 {
+			id, ok := ids[record.ID]
+			if !ok {
+				id = uint64(len(ids) + 1)
+				ids[record.ID] = id
+			}
+			record.ID = id
+		}
+		record.Metadata = stable(record.Metadata)
+		normalized[index] = record
+	}
+	return normalized
+}
+
+func stable(md message.Metadata) message.Metadata {
+	md = md.Clone()
+	for _, key := range Volatile {
+		delete(md, key)
+	}
+	if len(md) == 0 {
+		return nil
+	}
+	return md
+}
+
+// WriteRecords writes records as JSON lines.
+func WriteRecords(w io.Writer, records []Record) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadRecords reads records written by WriteRecords.
+func ReadRecords(r io.Reader) ([]Record, error) {
+	var records []Record
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<24)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var record Record
+		if err := json.Unmarshal(line, &record); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+// LoadRecords reads the records of a golden file.
+func LoadRecords(path string) ([]Record, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadRecords(file)
+}
+
+// Golden compares the normalized records with the golden file at path, the file is
+// written instead when tests run with -update-golden.
+func Golden(t testing.TB, path string, records []Record) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := WriteRecords(&buf, Normalize(records)); err != nil {
+		t.Fatalf("cannot encode records: %v", err)
+	}
+
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("cannot create directory of golden file: %v", err)
+		}
+		if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			t.Fatalf("cannot write golden file: %v", err)
+		}
+		return
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("cannot read golden file, run with -update-golden to create it: %v", err)
+	}
+	if diff := diffLines(string(data), buf.String()); diff != "" {
+		t.Errorf("records differ from %s, run with -update-golden to accept them:\n%s", path, diff)
+	}
+}
+
+// diffLines describes where got first differs from want, or returns "" when they are
+// the same.
+func diffLines(want, got string) string {
+	wantLines := strings.Split(strings.TrimRight(want, "\n"), "\n")
+	gotLines := strings.Split(strings.TrimRight(got, "\n"), "\n")
+	for index := 0; index < len(wantLines) || index < len(gotLines); index++ {
+		var w, g string
+		if index < len(wantLines) {
+			w = wantLines[index]
+		}
+		if index < len(gotLines) {
+			g = gotLines[index]
+		}
+		if w != g {
+			return fmt.Sprintf("line %d:\n- %s\n+ %s\n(%d lines expected, %d got)", index+1, w, g, len(wantLines), len(gotLines))
+		}
+	}
+	return ""
+}
@@ -0,0 +1,204 @@
+// Package devicetest records messages passing a point of a device tree, and replays
+// recorded requests into services to catch regressions.
+package devicetest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/acoderup/boost/device"
+	"github.com/acoderup/boost/encoding"
+	"github.com/acoderup/boost/message"
+	"github.com/acoderup/boost/route"
+)
+
+var (
+	ErrNoGateway = errors.New("recorder cannot attach to a device without gateway")
+)
+
+type Direction string
+
+const (
+	// In is a message dispatched into the recorded device.
+	In Direction = "in"
+	// Out is a message sent by the recorded device or any device under it.
+	Out Direction = "out"
+)
+
+// Record is a message captured by a Recorder, data which is valid JSON is kept as is
+// to make golden files readable.
+type Record struct {
+	Direction Direction        `json:"direction"`
+	ID        uint64           `json:"id"`
+	Src       []string         `json:"src,omitempty"`
+	Dst       []string         `json:"dst,omitempty"`
+	Encoding  string           `json:"encoding,omitempty"`
+	Encoder   []string         `json:"encoder,omitempty"`
+	Decoder   []string         `json:"decoder,omitempty"`
+	Metadata  message.Metadata `json:"metadata,omitempty"`
+	JSON      json.RawMessage  `json:"json,omitempty"`
+	Bytes     []byte           `json:"bytes,omitempty"`
+}
+
+func NewRecord(direction Direction, msg *message.Message) Record {
+	record := Record{
+		Direction: direction,
+		ID:        msg.ID,
+		Metadata:  msg.Metadata.Clone(),
+	}
+
+	if r, ok := msg.Route.(interface {
+		Src() []string
+		Dst() []string
+	}); ok {
+		record.Src, record.Dst = r.Src(), r.Dst()
+	}
+
+	switch e := msg.Encoding.(type) {
+	case nil:
+	case encoding.ChainEncoding:
+		record.Encoder, record.Decoder = e.Encoder(), e.Decoder()
+	case *encoding.ChainEncoding:
+		record.Encoder, record.Decoder = e.Encoder(), e.Decoder()
+	default:
+		record.Encoding = e.String()
+	}
+
+	data := append([]byte(nil), msg.Data...)
+	if len(data) > 0 && json.Valid(data) {
+		record.JSON = data
+	} else {
+		record.Bytes = data
+	}
+	return record
+}
+
+// Data returns the data of the recorded message.
+func (r Record) Data() []byte {
+	if r.JSON != nil {
+		return r.JSON
+	}
+	return r.Bytes
+}
+
+// Message rebuilds the recorded message, the route is dispatched from src to dst.
+func (r Record) Message() (*message.Message, error) {
+	msg := &message.Message{
+		ID:       r.ID,
+		Metadata: r.Metadata.Clone(),
+		Data:     r.Data(),
+	}
+	if r.Dst != nil {
+		msg.Route = route.NewChainRoute(r.Src, r.Dst)
+	}
+
+	switch {
+	case r.Encoding != "":
+		e, err := encoding.LocateEncoding(r.Encoding)
+		if err != nil {
+			return nil, err
+		}
+		msg.Encoding = e
+	case r.Encoder != nil:
+		msg.Encoding = encoding.NewChainEncoding(r.Encoder, r.Decoder)
+	}
+	return msg, nil
+}
+
+// Recorder records every message passing between a device and its gateway, it takes
+// the name of the device and is extended into routers in place of it.
+type Recorder struct {
+	device.Device
+	mutex   sync.Mutex
+	records []Record
+}
+
+// NewRecorder wraps d into a recorder, the recorder is integrated into routers instead of d.
+func NewRecorder(d device.Device) *Recorder {
+	return &Recorder{
+		Device: d,
+	}
+}
+
+// Attach puts a recorder between d and its gateway in a built tree, such as the
+// router of a service.
+func Attach(d device.Device) (*Recorder, error) {
+	gateway := d.Gateway()
+	s, ok := gateway.(interface{ Shrink(device.Device) })
+	if !ok {
+		return nil, ErrNoGateway
+	}
+	r := NewRecorder(d)
+	s.Shrink(d)
+	gateway.Extend(r)
+	r.Join(gateway)
+	return r, nil
+}
+
+func (r *Recorder) Key() string {
+	if k, ok := r.Device.(device.Keyer); ok {
+		return k.Key()
+	}
+	return strings.Join(device.Addr(r.Device), "/")
+}
+
+// Unwrap returns the device being recorded.
+func (r *Recorder) Unwrap() device.Device {
+	return r.Device
+}
+
+// Join lets d reach the gateway through the recorder, the address of d is kept.
+func (r *Recorder) Join(gateway device.Device) {
+	r.Device.Join(&tap{Device: gateway, recorder: r})
+}
+
+func (r *Recorder) Process(ctx context.Context, msg *message.Message) error {
+	if msg.Route.Dispatching() {
+		r.record(In, msg)
+	}
+	return r.Device.Process(ctx, msg)
+}
+
+// Records returns what has been recorded so far in order.
+func (r *Recorder) Records() []Record {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return append([]Record(nil), r.records...)
+}
+
+func (r *Recorder) Reset() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.records = nil
+}
+
+func (r *Recorder) record(direction Direction, msg *message.Message) {
+	record := NewRecord(direction, msg)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.records = append(r.records, record)
+}
+
+// tap stands for the gateway of the recorded device, it records messages going up.
+type tap struct {
+	device.Device
+	recorder *Recorder
+}
+
+func (t *tap) Process(ctx context.Context, msg *message.Message) error {
+	t.recorder.record(Out, msg)
+	return t.Device.Process(ctx, msg)
+}
+
+// Unwrap returns the gateway, so the recorded device keeps the interceptors and dead
+// letters of its routers.
+func (t *tap) Unwrap() device.Device {
+	return t.Device
+}
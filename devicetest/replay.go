@@ -0,0 +1,186 @@
+package devicetest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/acoderup/boost/device"
+	"github.com/acoderup/boost/message"
+	"github.com/acoderup/boost/route"
+	"github.com/acoderup/boost/service"
+)
+
+// Mismatch is a replayed request whose replies differ from the recorded ones.
+type Mismatch struct {
+	Request  Record
+	Expected []Record
+	Actual   []Record
+	Err      error
+}
+
+func (m Mismatch) String() string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "request %d to %s", m.Request.ID, strings.Join(m.Request.Dst, "/"))
+	if m.Err != nil {
+		fmt.Fprintf(&builder, " failed: %v", m.Err)
+	}
+	builder.WriteString("\n")
+	for _, record := range m.Expected {
+		fmt.Fprintf(&builder, "- %s\n", line(record))
+	}
+	for _, record := range m.Actual {
+		fmt.Fprintf(&builder, "+ %s\n", line(record))
+	}
+	return builder.String()
+}
+
+func line(record Record) string {
+	data, _ := json.Marshal(Normalize([]Record{record})[0])
+	return string(data)
+}
+
+type exchange struct {
+	request Record
+	replies []Record
+}
+
+// exchanges pairs every request with its replies, a request is the first record of
+// an ID, and its replies are the later records of the ID going the other way.
+func exchanges(records []Record) []*exchange {
+	var result []*exchange
+	byID := make(map[uint64]*exchange)
+	for _, record := range records {
+		if record.ID == 0 {
+			result = append(result, &exchange{request: record})
+			continue
+		}
+		e, ok := byID[record.ID]
+		if !ok {
+			e = &exchange{request: record}
+			byID[record.ID] = e
+			result = append(result, e)
+			continue
+		}
+		if record.Direction != e.request.Direction {
+			e.replies = append(e.replies, record)
+		}
+	}
+	return result
+}
+
+// Replay re-sends the requests among records into s in order, and returns those whose
+// replies differ in encoding, metadata or data from the recorded ones. Every request
+// waits for its final reply up to the timeout of the service.
+func Replay(s *service.Service, records []Record) ([]Mismatch, error) {
+	client := s.Client()
+	var mismatches []Mismatch
+	for _, e := range exchanges(records) {
+		msg, err := e.request.Message()
+		if err != nil {
+			return mismatches, err
+		}
+		msg.Route = route.NewChainRoute(device.Addr(client), e.request.Dst)
+
+		if len(e.replies) == 0 {
+			// Nothing to wait for, such as a request to a one-way handler
+			if err := client.Send(context.Background(), msg); err != nil {
+				mismatches = append(mismatches, Mismatch{Request: e.request, Err: err})
+			}
+			continue
+		}
+
+		actual, err := invoke(s, msg)
+		if err != nil || !equalReplies(e.replies, actual) {
+			mismatches = append(mismatches, Mismatch{
+				Request:  e.request,
+				Expected: e.replies,
+				Actual:   actual,
+				Err:      err,
+			})
+		}
+	}
+	return mismatches, nil
+}
+
+func invoke(s *service.Service, msg *message.Message) ([]Record, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+
+	var mutex sync.Mutex
+	var replies []Record
+	done := make(chan struct{})
+	err := s.Client().Invoke(ctx, msg, device.NewFuncProcessor(func(_ context.Context, reply *message.Message) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		replies = append(replies, NewRecord(In, reply))
+		if !device.Streaming(reply) {
+			close(done)
+		}
+		return nil
+	}))
+	if err == nil {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	return append([]Record(nil), replies...), err
+}
+
+func equalReplies(expected, actual []Record) bool {
+	if len(expected) != len(actual) {
+		return false
+	}
+	for index := range expected {
+		if !equalReply(expected[index], actual[index]) {
+			return false
+		}
+	}
+	return true
+}
+
+func equalReply(a, b Record) bool {
+	if a.Encoding != b.Encoding || strings.Join(a.Encoder, ",") != strings.Join(b.Encoder, ",") ||
+		strings.Join(a.Decoder, ",") != strings.Join(b.Decoder, ",") {
+		return false
+	}
+	if !maps.Equal(stable(a.Metadata), stable(b.Metadata)) {
+		return false
+	}
+	if a.JSON != nil && b.JSON != nil {
+		var x, y bytes.Buffer
+		if json.Compact(&x, a.JSON) == nil && json.Compact(&y, b.JSON) == nil {
+			return bytes.Equal(x.Bytes(), y.Bytes())
+		}
+	}
+	return bytes.Equal(a.Data(), b.Data())
+}
+
+// ReplayGolden replays the records of the golden file at path into s, and fails t with
+// every mismatch.
+func ReplayGolden(t testing.TB, s *service.Service, path string) {
+	t.Helper()
+
+	records, err := LoadRecords(path)
+	if err != nil {
+		t.Fatalf("cannot load golden file: %v", err)
+	}
+	mismatches, err := Replay(s, records)
+	if err != nil {
+		t.Fatalf("cannot replay %s: %v", path, err)
+	}
+	for _, m := range mismatches {
+		t.Errorf("replies differ from %s:\n%s", path, m)
+	}
+}
@@ -25,6 +25,14 @@ func NewChainEncoding(encoder, decoder []string) *ChainEncoding {
 
 var empty *ChainEncoding = NewChainEncoding([]string{"Lazy"}, []string{"Lazy"})
 
+func (c ChainEncoding) Encoder() []string {
+	return c.encoder
+}
+
+func (c ChainEncoding) Decoder() []string {
+	return c.decoder
+}
+
 func (c ChainEncoding) String() string {
 	var builder strings.Builder
 	builder.WriteString(magic.SeparatorBracketLeft)
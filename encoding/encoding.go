@@ -104,6 +104,10 @@ func (es EncodingSet) register(encodings ...Encoding) {
 	}
 }
 
+func LocateEncoding(name string) (Encoding, error) {
+	return encodingSet.locateEncoding(name)
+}
+
 func localEncoding(name string) (Encoding, error) {
 	return encodingSet.locateEncoding(name)
 }
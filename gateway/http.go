@@ -0,0 +1,293 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync/atomic"
+
+	"github.com/acoderup/boost/device"
+	"github.com/acoderup/boost/encoding"
+	"github.com/acoderup/boost/magic"
+	"github.com/acoderup/boost/message"
+	"github.com/acoderup/boost/route"
+	"github.com/acoderup/boost/service"
+)
+
+var (
+	ErrUnsupportedContentType = errors.New("gateway cannot find encoding by content type")
+)
+
+const contentTypeJSON = "application/json"
+
+const kindGateway = "gateway"
+
+var contentTypeEncodings = map[string]encoding.Encoding{
+	contentTypeJSON:            encoding.NewJSON(),
+	"application/xml":          encoding.NewXML(),
+	"text/xml":                 encoding.NewXML(),
+	"application/yaml":         encoding.NewYAML(),
+	"application/x-yaml":       encoding.NewYAML(),
+	"text/yaml":                encoding.NewYAML(),
+	"application/protobuf":     encoding.NewProtobuf(),
+	"application/x-protobuf":   encoding.NewProtobuf(),
+	"application/octet-stream": encoding.NewLazy(),
+}
+
+// metadataHeaders are request headers carried as message metadata under the same name,
+// and the metadata of responses written back as headers.
+var metadataHeaders = []string{
+	message.MetadataTraceID,
+	message.MetadataUserID,
+	message.MetadataSessionID,
+	message.MetadataDeadline,
+	message.MetadataAuth,
+	message.MetadataLocale,
+	message.MetadataVersion,
+}
+
+// HTTP exposes handlers under a router as REST endpoints, `POST /<router>/<handler-name>`
+// is routed to the handler the same way as a message sent by a client on the bus. The
+// URL path is parsed as a route.PathRoute, so routers named like "{roomID}" capture
+// path parameters.
+type HTTP struct {
+	Options
+	client *device.Client
+	router *device.Router
+	prefix []string
+}
+
+var _ http.Handler = (*HTTP)(nil)
+
+// gateways numbers the clients of gateways, so gateways sharing a bus never share the
+// group their replies are routed to.
+var gateways uint64
+
+// NewHTTP attaches a client to the bus the router belongs to, a standalone router is
+// integrated into a new bus.
+func NewHTTP(router *device.Router, opts ...Option) *HTTP {
+	bus := root(router)
+	client := device.NewClient(fmt.Sprintf("%s%d", magic.Gateway, atomic.AddUint64(&gateways, 1)))
+	bus.Extend(client)
+	client.Join(bus)
+
+	return newHTTP(client, router, opts...)
+}
+
+func NewServiceHTTP(s *service.Service, opts ...Option) *HTTP {
+	return newHTTP(s.Client(), s.Router(), opts...)
+}
+
+func newHTTP(client *device.Client, router *device.Router, opts ...Option) *HTTP {
+	h := &HTTP{
+		Options: defaultOptions,
+		client:  client,
+		router:  router,
+	}
+	for _, opt := range opts {
+		opt(&h.Options)
+	}
+
+	h.prefix = prefixOf(router)
+	return h
+}
+
+// prefixOf returns the address of the parent of router as the start of destinations,
+// where the bus is empty.
+func prefixOf(router *device.Router) []string {
+	addr := device.Addr(router)
+	prefix := make([]string, len(addr)-1)
+	copy(prefix[1:], addr[1:len(addr)-1])
+	return prefix
+}
+
+// confined reports whether dst reaches under router, a gateway must not let clients
+// address devices elsewhere on the bus such as other sessions.
+func confined(dst, prefix []string, router *device.Router) bool {
+	return len(dst) > len(prefix)+1 && slices.Equal(dst[:len(prefix)], prefix) &&
+		dst[len(prefix)] == router.String()
+}
+
+func (h *HTTP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	contentType, e, err := Encoding(r.Header.Get("Content-Type"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.MaxBodySize))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	path, err := route.ParsePath(r.URL.Path)
+	if err == nil {
+		path = path.Under(h.prefix)
+	}
+	if err != nil || !confined(path.Dst(), h.prefix, h.router) {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.Timeout)
+	defer cancel()
+
+	var md message.Metadata
+	for _, key := range metadataHeaders {
+		if value := r.Header.Get(key); value != "" {
+			md.Set(key, value)
+		}
+	}
+
+	msg := &message.Message{
+		Route:    path.From(device.Addr(h.client)),
+		Encoding: e,
+		Metadata: md,
+		Data:     data,
+	}
+	end := func(error) {}
+	if h.Tracer != nil {
+		ctx, end = device.Trace(ctx, h.Tracer, "HTTP "+r.URL.Path, kindGateway, msg)
+	}
+
+	if h.oneWay(path.Dst()) {
+		// Nothing replies, so the message is accepted once it is delivered
+		err = h.client.Send(ctx, msg)
+		end(err)
+		if err != nil {
+			http.Error(w, err.Error(), StatusCode(err))
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	resp, err := h.invoke(ctx, msg)
+	if err != nil {
+		end(err)
+		http.Error(w, err.Error(), StatusCode(err))
+		return
+	}
+	err = device.ErrorOf(resp)
+	end(err)
+
+	for _, key := range metadataHeaders {
+		if value := resp.Metadata.Get(key); value != "" {
+			w.Header().Set(key, value)
+		}
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(StatusCode(err))
+	w.Write(resp.Data)
+}
+
+// oneWay reports whether dst reaches a one-way handler, which never replies.
+func (h *HTTP) oneWay(dst []string) bool {
+	var d device.Device = h.router
+	for _, name := range dst[len(h.prefix)+1:] {
+		if d = d.Locate(name); d == nil {
+			return false
+		}
+	}
+	for {
+		u, ok := d.(interface{ Unwrap() device.Device })
+		if !ok {
+			break
+		}
+		d = u.Unwrap()
+	}
+	handler, ok := d.(*device.Handler)
+	return ok && handler.Mode() == "one-way"
+}
+
+func (h *HTTP) invoke(ctx context.Context, msg *message.Message) (*message.Message, error) {
+	respChan := make(chan *message.Message, 1)
+	err := h.client.Invoke(ctx, msg, device.NewFuncProcessor(func(_ context.Context, msg *message.Message) error {
+		// Only the first response of a stream is written
+		select {
+		case respChan <- msg:
+		default:
+		}
+		return nil
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case resp := <-respChan:
+		return resp, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Encoding picks the encoding by the media type of content type, JSON is used when
+// content type is empty.
+func Encoding(contentType string) (string, encoding.Encoding, error) {
+	if contentType == "" {
+		return contentTypeJSON, contentTypeEncodings[contentTypeJSON], nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", nil, ErrUnsupportedContentType
+	}
+	e, ok := contentTypeEncodings[mediaType]
+	if !ok {
+		return "", nil, ErrUnsupportedContentType
+	}
+	return mediaType, e, nil
+}
+
+var errorCodeStatus = map[device.ErrorCode]int{
+	device.CodeUnknown:            http.StatusInternalServerError,
+	device.CodeInvalidArgument:    http.StatusBadRequest,
+	device.CodeNotFound:           http.StatusNotFound,
+	device.CodeAlreadyExists:      http.StatusConflict,
+	device.CodePermissionDenied:   http.StatusForbidden,
+	device.CodeUnauthenticated:    http.StatusUnauthorized,
+	device.CodeResourceExhausted:  http.StatusTooManyRequests,
+	device.CodeFailedPrecondition: http.StatusPreconditionFailed,
+	device.CodeDeadlineExceeded:   http.StatusGatewayTimeout,
+	device.CodeCanceled:           http.StatusServiceUnavailable,
+	device.CodeUnavailable:        http.StatusServiceUnavailable,
+	device.CodeInternal:           http.StatusInternalServerError,
+}
+
+// StatusCode maps an error returned by the device tree, or carried by an error
+// response, to a HTTP status code.
+func StatusCode(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+	if status, ok := errorCodeStatus[device.AsError(err).Code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+func root(d device.Device) device.Device {
+	for d.Gateway() != nil {
+		d = d.Gateway()
+	}
+	if router, ok := d.(*device.Router); ok && !router.IsBus() {
+		return device.NewBus().Integrate(router)
+	}
+	return d
+}
@@ -0,0 +1,254 @@
+package gateway_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/acoderup/boost/device"
+	"github.com/acoderup/boost/gateway"
+	"github.com/acoderup/boost/message"
+	"github.com/acoderup/boost/service"
+	"github.com/acoderup/boost/tracing"
+)
+
+type Try struct{}
+
+type Ping struct {
+	Text string `json:"text"`
+}
+
+type Pong struct {
+	Text string `json:"text"`
+}
+
+func (t *Try) Echo(_ context.Context, req *Ping) (*Pong, error) {
+	switch req.Text {
+	case "":
+		return nil, errors.New("empty text")
+	case "busy":
+		return nil, device.NewError(device.CodeUnavailable, "try later").WithRetryable()
+	}
+	return &Pong{Text: req.Text}, nil
+}
+
+func (t *Try) EchoBytes(_ context.Context, req []byte) ([]byte, error) {
+	return req, nil
+}
+
+func post(t *testing.T, url, contentType, body string) (int, string) {
+	resp, err := http.Post(url, contentType, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatalf("unexpected error posting: %v", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("unexpected error reading: %v", err)
+	}
+	return resp.StatusCode, string(bytes.TrimSpace(data))
+}
+
+func TestHTTP(t *testing.T) {
+	server := httptest.NewServer(gateway.NewServiceHTTP(service.New(&Try{})))
+	defer server.Close()
+
+	cases := []struct {
+		path        string
+		contentType string
+		body        string
+		status      int
+		resp        string
+	}{
+		{"/server/echo", "application/json", `{"text":"hello"}`, http.StatusOK, `{"text":"hello"}`},
+		{"/server/echo", "", `{"text":"hello"}`, http.StatusOK, `{"text":"hello"}`},
+		{"/server/echo-bytes", "application/octet-stream", "raw", http.StatusOK, "raw"},
+		{"/server/echo", "application/json", `{"text":`, http.StatusBadRequest, ""},
+		{"/server/echo", "application/json", `{"text":""}`, http.StatusInternalServerError, `{"code":0,"message":"empty text"}`},
+		{"/server/echo", "application/json", `{"text":"busy"}`, http.StatusServiceUnavailable, ""},
+		{"/server/missing", "application/json", `{}`, http.StatusNotFound, ""},
+		{"/server/*", "application/json", `{}`, http.StatusNotFound, ""},
+		{"/server/echo", "text/plain", `{}`, http.StatusUnsupportedMediaType, ""},
+	}
+	for _, c := range cases {
+		status, resp := post(t, server.URL+c.path, c.contentType, c.body)
+		if status != c.status {
+			t.Fatalf("%s %q: expecting status %d, got %d (%s)", c.path, c.body, c.status, status, resp)
+		}
+		if c.resp != "" && resp != c.resp {
+			t.Fatalf("%s %q: expecting response %q, got %q", c.path, c.body, c.resp, resp)
+		}
+	}
+
+	resp, err := http.Get(server.URL + "/server/echo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("expecting status %d, got %d", http.StatusMethodNotAllowed, resp.StatusCode)
+	}
+}
+
+func TestHTTPRouter(t *testing.T) {
+	try := device.NewRouter("Try").Integrate(&Try{})
+	device.NewRouter("1.0.0").Integrate(try)
+
+	server := httptest.NewServer(gateway.NewHTTP(try))
+	defer server.Close()
+
+	status, resp := post(t, server.URL+"/try/echo", "application/json", `{"text":"nested"}`)
+	if status != http.StatusOK || resp != `{"text":"nested"}` {
+		t.Fatalf("unexpected response %d %s", status, resp)
+	}
+}
+
+func TestHTTPGateways(t *testing.T) {
+	try := device.NewRouter("Try").Integrate(&Try{})
+	var urls []string
+	for range 2 {
+		server := httptest.NewServer(gateway.NewHTTP(try))
+		defer server.Close()
+		urls = append(urls, server.URL)
+	}
+
+	// Replies of either gateway never reach the client of the other one
+	var wg sync.WaitGroup
+	for index := range 200 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			text := fmt.Sprintf(`{"text":"%d"}`, index)
+			status, resp := post(t, urls[index%2]+"/try/echo", "application/json", text)
+			if status != http.StatusOK || resp != text {
+				t.Errorf("unexpected response %d %s", status, resp)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestHTTPLimits(t *testing.T) {
+	server := httptest.NewServer(gateway.NewServiceHTTP(service.New(&Try{}), gateway.WithMaxBodySize(16)))
+	defer server.Close()
+
+	if status, _ := post(t, server.URL+"/server/echo", "application/json", `{"text":"far too long"}`); status != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expecting status %d, got %d", http.StatusRequestEntityTooLarge, status)
+	}
+
+	// Only the metadata allowed for requests is written back as headers
+	resp, err := http.Post(server.URL+"/server/echo", "application/json", bytes.NewBufferString(`{"text":""}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError || resp.Header.Get(message.MetadataError) != "" {
+		t.Fatalf("expecting an error without error header, got %d %v", resp.StatusCode, resp.Header)
+	}
+}
+
+type Feed struct {
+	notified chan string
+}
+
+func (f *Feed) Notify(_ context.Context, req *Ping) error {
+	if req.Text == "" {
+		return errors.New("empty text")
+	}
+	f.notified <- req.Text
+	return nil
+}
+
+func TestHTTPOneWay(t *testing.T) {
+	feed := &Feed{notified: make(chan string, 1)}
+	server := httptest.NewServer(gateway.NewHTTP(device.NewRouter("Feed").Integrate(feed), gateway.WithTimeout(time.Second)))
+	defer server.Close()
+
+	// One-way handlers are answered once delivered instead of waiting for a reply
+	if status, _ := post(t, server.URL+"/feed/notify", "application/json", `{"text":"goal"}`); status != http.StatusAccepted {
+		t.Fatalf("expecting status %d, got %d", http.StatusAccepted, status)
+	}
+	if text := <-feed.notified; text != "goal" {
+		t.Fatalf("unexpected notified %q", text)
+	}
+	if status, _ := post(t, server.URL+"/feed/notify", "application/json", `{"text":""}`); status != http.StatusInternalServerError {
+		t.Fatalf("expecting status %d, got %d", http.StatusInternalServerError, status)
+	}
+}
+
+type Room struct{}
+
+func (*Room) Echo(ctx context.Context, req *Ping) (*Pong, error) {
+	return &Pong{Text: device.ParamFrom(ctx, "roomID") + ":" + req.Text}, nil
+}
+
+func TestHTTPPathParams(t *testing.T) {
+	room := device.NewRouter("Room").Integrate(device.NewRouter("{roomID}").Integrate(&Room{}))
+	device.NewRouter("1.0.0").Integrate(room)
+	h := gateway.NewHTTP(room)
+
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	status, resp := post(t, server.URL+"/room/Hall-42/echo", "application/json", `{"text":"hi"}`)
+	if status != http.StatusOK || resp != `{"text":"Hall-42:hi"}` {
+		t.Fatalf("unexpected response %d %s", status, resp)
+	}
+
+	echo := h.OpenAPI("Room", "1.0.0").Paths["/room/{roomID}/echo"]
+	if echo == nil || echo.Post.Parameters[0].Name != "roomID" || echo.Post.Parameters[0].In != "path" {
+		t.Fatalf("expecting the path parameter, got %+v", echo)
+	}
+}
+
+func TestHTTPTracing(t *testing.T) {
+	memory := tracing.NewMemoryExporter()
+	tracer := tracing.NewTracer(memory)
+	defer device.Observe(device.Tracing(tracer))()
+
+	server := httptest.NewServer(gateway.NewServiceHTTP(service.New(&Try{}), gateway.WithTracer(tracer)))
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/server/echo", bytes.NewBufferString(`{"text":""}`))
+	req.Header.Set(message.MetadataTraceID, "trace-1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if id := resp.Header.Get(message.MetadataTraceID); id != "trace-1" {
+		t.Fatalf("expecting trace ID in response, got %q", id)
+	}
+
+	spans := memory.Trace("trace-1")
+	ids := map[string]tracing.Span{}
+	for _, span := range spans {
+		ids[span.SpanID] = span
+	}
+	var path []string
+	for _, span := range spans {
+		if span.ParentID == "" {
+			if span.Kind != "gateway" {
+				t.Fatalf("expecting gateway root, got %+v", span)
+			}
+		} else if _, ok := ids[span.ParentID]; !ok {
+			t.Fatalf("expecting parent of %+v in the trace", span)
+		}
+		path = append(path, span.Name)
+	}
+	expected := "HTTP /server/echo / /Server /Server/Echo /"
+	if strings.Join(path, " ") != expected {
+		t.Fatalf("expecting path %q, got %q", expected, strings.Join(path, " "))
+	}
+	if handler := spans[3]; handler.Error != "empty text" || handler.Encoding != "JSON" {
+		t.Fatalf("unexpected handler span %+v", handler)
+	}
+}
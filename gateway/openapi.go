@@ -0,0 +1,175 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/acoderup/boost/device"
+	"github.com/acoderup/boost/magic"
+	"github.com/acoderup/boost/route"
+	"github.com/acoderup/boost/style"
+)
+
+const openAPIVersion = "3.1.0"
+
+const refComponents = "#/components/schemas/"
+
+// OpenAPI is the document describing the endpoints of an HTTP gateway.
+type OpenAPI struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       OpenAPIInfo          `json:"info"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+}
+
+type OpenAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type PathItem struct {
+	Post *Operation `json:"post,omitempty"`
+}
+
+type Operation struct {
+	OperationID string               `json:"operationId"`
+	Description string               `json:"description,omitempty"`
+	Parameters  []Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+type Parameter struct {
+	Name     string         `json:"name"`
+	In       string         `json:"in"`
+	Required bool           `json:"required,omitempty"`
+	Schema   *device.Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *device.Schema `json:"schema"`
+}
+
+type Components struct {
+	Schemas map[string]*device.Schema `json:"schemas"`
+}
+
+var _ http.Handler = (*OpenAPI)(nil)
+
+// OpenAPI describes the handlers reachable through the gateway, with JSON bodies and
+// the metadata headers. Only unary handlers are described, since a request over HTTP
+// gets exactly one reply, and only the latest version of a versioned handler.
+func (h *HTTP) OpenAPI(title, version string) *OpenAPI {
+	doc := &OpenAPI{
+		OpenAPI: openAPIVersion,
+		Info: OpenAPIInfo{
+			Title:   title,
+			Version: version,
+		},
+		Paths: make(map[string]*PathItem),
+	}
+	schemas := device.NewSchemas(refComponents)
+	errorSchema := schemas.Of(reflect.TypeOf(device.Error{}))
+
+	var parameters []Parameter
+	for _, key := range metadataHeaders {
+		parameters = append(parameters, Parameter{
+			Name:   key,
+			In:     "header",
+			Schema: &device.Schema{Type: "string"},
+		})
+	}
+
+	// Paths are relative to the parent of the router, as in ServeHTTP
+	depth := len(device.Addr(h.router)) - 1
+	infos := h.router.Handlers()
+	for index, info := range infos {
+		// Versions are listed from the oldest, only the latest is described
+		if info.Mode != "unary" || index+1 < len(infos) && infos[index+1].Path == info.Path {
+			continue
+		}
+		chain := strings.Split(info.Path, "/")[depth:]
+		path, params := openAPIPath(chain)
+
+		doc.Paths[path] = &PathItem{
+			Post: &Operation{
+				OperationID: strings.Map(func(r rune) rune {
+					if strings.ContainsRune("{}*", r) {
+						return -1
+					}
+					return r
+				}, strings.Join(chain, "")),
+				Description: info.Signature,
+				Parameters:  append(params, parameters...),
+				RequestBody: &RequestBody{
+					Required: true,
+					Content: map[string]MediaType{
+						contentTypeJSON: {Schema: schemas.Of(info.RequestType)},
+					},
+				},
+				Responses: map[string]*Response{
+					"200": {
+						Description: "OK",
+						Content: map[string]MediaType{
+							contentTypeJSON: {Schema: schemas.Of(info.ResponseType)},
+						},
+					},
+					"default": {
+						Description: "Error",
+						Content: map[string]MediaType{
+							contentTypeJSON: {Schema: errorSchema},
+						},
+					},
+				},
+			},
+		}
+	}
+	doc.Components.Schemas = schemas.Definitions
+	return doc
+}
+
+// openAPIPath returns the URL path of the device names, with parameters for the
+// segments matched by patterns.
+func openAPIPath(chain []string) (string, []Parameter) {
+	var builder strings.Builder
+	var params []Parameter
+	for _, name := range chain {
+		builder.WriteString(magic.SeparatorSlash)
+		param, ok := route.Param(name)
+		if !ok && name == route.Wildcard {
+			param, ok = "wildcard", true
+		}
+		if !ok {
+			builder.WriteString(style.Destandardize(name, magic.SeparatorHyphen))
+			continue
+		}
+		builder.WriteString("{" + param + "}")
+		params = append(params, Parameter{
+			Name:     param,
+			In:       "path",
+			Required: true,
+			Schema:   &device.Schema{Type: "string"},
+		})
+	}
+	return builder.String(), params
+}
+
+// ServeHTTP serves the document as JSON.
+func (doc *OpenAPI) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", contentTypeJSON)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(doc)
+}
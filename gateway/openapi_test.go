@@ -0,0 +1,40 @@
+package gateway_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/acoderup/boost/gateway"
+	"github.com/acoderup/boost/service"
+)
+
+func TestOpenAPI(t *testing.T) {
+	h := gateway.NewServiceHTTP(service.New(&Try{}))
+	doc := h.OpenAPI("Try", "1.0.0")
+
+	echo := doc.Paths["/server/echo"]
+	if echo == nil || echo.Post == nil || doc.Paths["/server/echo-bytes"] == nil {
+		t.Fatalf("unexpected paths %v", doc.Paths)
+	}
+	if ref := echo.Post.RequestBody.Content["application/json"].Schema.Ref; ref != "#/components/schemas/Ping" {
+		t.Fatalf("unexpected request schema %q", ref)
+	}
+	if ref := echo.Post.Responses["200"].Content["application/json"].Schema.Ref; ref != "#/components/schemas/Pong" {
+		t.Fatalf("unexpected response schema %q", ref)
+	}
+	ping := doc.Components.Schemas["Ping"]
+	if ping == nil || ping.Properties["text"] == nil || ping.Properties["text"].Type != "string" {
+		t.Fatalf("unexpected components %+v", doc.Components.Schemas)
+	}
+	if doc.Components.Schemas["Error"] == nil {
+		t.Fatal("expecting the error envelope in components")
+	}
+
+	w := httptest.NewRecorder()
+	doc.ServeHTTP(w, httptest.NewRequest("GET", "/openapi.json", nil))
+	decoded := map[string]interface{}{}
+	if err := json.Unmarshal(w.Body.Bytes(), &decoded); err != nil || decoded["openapi"] != "3.1.0" {
+		t.Fatalf("unexpected document %s: %v", w.Body.String(), err)
+	}
+}
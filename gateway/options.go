@@ -0,0 +1,54 @@
+package gateway
+
+import (
+	"time"
+
+	"github.com/acoderup/boost/tracing"
+)
+
+type Option func(*Options)
+
+type Options struct {
+	Timeout     time.Duration
+	Tracer      *tracing.Tracer
+	MaxBodySize int64
+	Origins     []string
+}
+
+var defaultOptions = Options{
+	Timeout:     10 * time.Second,
+	MaxBodySize: 4 << 20,
+}
+
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *Options) {
+		o.Timeout = timeout
+	}
+}
+
+// WithMaxBodySize limits the size in bytes of request bodies, larger requests are
+// rejected with 413. A size which is not positive keeps the default.
+func WithMaxBodySize(size int64) Option {
+	return func(o *Options) {
+		if size <= 0 {
+			size = defaultOptions.MaxBodySize
+		}
+		o.MaxBodySize = size
+	}
+}
+
+// WithOrigins sets the origins WebSocket upgrades are accepted from. Without origins,
+// an upgrade carrying an Origin header is only accepted from the host it is sent to.
+func WithOrigins(origins ...string) Option {
+	return func(o *Options) {
+		o.Origins = origins
+	}
+}
+
+// WithTracer records a span for every request, the spans of the hops on the bus are
+// its children.
+func WithTracer(tracer *tracing.Tracer) Option {
+	return func(o *Options) {
+		o.Tracer = tracer
+	}
+}
@@ -0,0 +1,178 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/acoderup/boost/device"
+	"github.com/acoderup/boost/message"
+	"github.com/acoderup/boost/route"
+	"github.com/acoderup/boost/safe"
+)
+
+var (
+	ErrRouteOutOfScope = errors.New("route leaves the router of the gateway")
+)
+
+const sessionPrefix = "Session"
+
+// sessions numbers the sessions of every gateway, so gateways sharing a bus never
+// name two sessions alike.
+var sessions uint64
+
+type shrinker interface {
+	Shrink(device.Device)
+}
+
+// WebSocket serves long-lived client sessions. Every connection gets its own client
+// device on the bus, binary frames carry messages in the envelope of message.Marshal.
+// Incoming messages are routed from the session address, so handler responses and
+// messages pushed to the session address are written back on the same socket. Routes
+// are confined under the router, as the paths of HTTP are.
+type WebSocket struct {
+	Options
+	bus      device.Device
+	router   *device.Router
+	prefix   []string
+	sessions sync.Map
+}
+
+var _ http.Handler = (*WebSocket)(nil)
+
+func NewWebSocket(router *device.Router, opts ...Option) *WebSocket {
+	ws := &WebSocket{
+		Options: defaultOptions,
+		bus:     root(router),
+		router:  router,
+	}
+	for _, opt := range opts {
+		opt(&ws.Options)
+	}
+	ws.prefix = prefixOf(router)
+	return ws
+}
+
+// Session returns the client device of a connected session by name.
+func (ws *WebSocket) Session(name string) (*device.Client, bool) {
+	v, ok := ws.sessions.Load(name)
+	if !ok {
+		return nil, false
+	}
+	return v.(*device.Client), true
+}
+
+// Sessions returns the names of all connected sessions.
+func (ws *WebSocket) Sessions() []string {
+	var names []string
+	ws.sessions.Range(func(key, _ any) bool {
+		names = append(names, key.(string))
+		return true
+	})
+	return names
+}
+
+// allowOrigin reports whether the upgrade may come from the origin of r, requests
+// without origin do not come from browsers.
+func (ws *WebSocket) allowOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if len(ws.Origins) > 0 {
+		return slices.Contains(ws.Origins, origin)
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+func (ws *WebSocket) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !ws.allowOrigin(r) {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+	conn, err := Upgrade(w, r)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	name := fmt.Sprintf("%s%d", sessionPrefix, atomic.AddUint64(&sessions, 1))
+	session := device.NewClient(name).Fallback(device.NewFuncProcessor(func(_ context.Context, msg *message.Message) error {
+		data, err := message.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		return conn.WriteMessage(BinaryMessage, data)
+	}))
+	ws.bus.Extend(session)
+	session.Join(ws.bus)
+	ws.sessions.Store(name, session)
+	defer func() {
+		ws.sessions.Delete(name)
+		if s, ok := ws.bus.(shrinker); ok {
+			s.Shrink(session)
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if messageType != BinaryMessage {
+			continue
+		}
+
+		msg, err := message.Unmarshal(data)
+		if err != nil {
+			conn.WriteMessage(TextMessage, []byte(err.Error()))
+			continue
+		}
+		r, ok := msg.Route.(route.ChainRoute)
+		if !ok {
+			conn.WriteMessage(TextMessage, []byte(message.ErrCodecUnsupportedRoute.Error()))
+			continue
+		}
+		dst := append(slices.Clone(ws.prefix), r.Dst()[min(1, len(r.Dst())):]...)
+		if !confined(dst, ws.prefix, ws.router) {
+			conn.WriteMessage(TextMessage, []byte(r.Error(ErrRouteOutOfScope).Error()))
+			continue
+		}
+		msg.Route = route.NewChainRoute(device.Addr(session), dst)
+		// Clients set the same metadata as the headers of HTTP requests
+		var md message.Metadata
+		for _, key := range metadataHeaders {
+			if value := msg.Metadata.Get(key); value != "" {
+				md.Set(key, value)
+			}
+		}
+		md.Set(message.MetadataSessionID, name)
+		msg.Metadata = md
+
+		go safe.Default().Do(func() error {
+			ctx, cancel := context.WithTimeout(ctx, ws.Timeout)
+			defer cancel()
+			end := func(error) {}
+			if ws.Tracer != nil {
+				ctx, end = device.Trace(ctx, ws.Tracer, "WebSocket "+name, kindGateway, msg)
+			}
+
+			err := session.Process(ctx, msg)
+			end(err)
+			if err != nil {
+				return conn.WriteMessage(TextMessage, []byte(err.Error()))
+			}
+			return nil
+		})
+	}
+}
@@ -0,0 +1,318 @@
+package gateway
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrWebSocketHandshake   = errors.New("websocket handshake failed")
+	ErrWebSocketProtocol    = errors.New("websocket protocol is violated")
+	ErrWebSocketMessageSize = errors.New("websocket message exceeds the maximum size")
+	ErrWebSocketClosed      = errors.New("websocket is closed")
+)
+
+// Message types defined by RFC 6455.
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+	CloseMessage  = 8
+	PingMessage   = 9
+	PongMessage   = 10
+)
+
+const (
+	webSocketGUID           = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	webSocketMaxMessageSize = 64 << 20
+	webSocketMaxControlSize = 125
+)
+
+// WebSocketConn is a minimal RFC 6455 connection, it supports text, binary and
+// fragmented messages, answers pings and performs the closing handshake.
+type WebSocketConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	client bool
+	wMutex sync.Mutex
+	once   sync.Once
+}
+
+func newWebSocketConn(conn net.Conn, reader *bufio.Reader, client bool) *WebSocketConn {
+	return &WebSocketConn{
+		conn:   conn,
+		reader: reader,
+		client: client,
+	}
+}
+
+// Upgrade performs the server side handshake and takes over the connection.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*WebSocketConn, error) {
+	if r.Method != http.MethodGet ||
+		!headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket") ||
+		r.Header.Get("Sec-WebSocket-Version") != "13" ||
+		r.Header.Get("Sec-WebSocket-Key") == "" {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return nil, ErrWebSocketHandshake
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return nil, ErrWebSocketHandshake
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	rw.WriteString("Upgrade: websocket\r\n")
+	rw.WriteString("Connection: Upgrade\r\n")
+	rw.WriteString("Sec-WebSocket-Accept: " + acceptKey(r.Header.Get("Sec-WebSocket-Key")) + "\r\n\r\n")
+	if err = rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return newWebSocketConn(conn, rw.Reader, false), nil
+}
+
+// DialWebSocket performs the client side handshake against a ws:// url.
+func DialWebSocket(ctx context.Context, rawURL string) (*WebSocketConn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "ws" {
+		return nil, fmt.Errorf("%w: unsupported scheme %s", ErrWebSocketHandshake, u.Scheme)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(host, "80")
+	}
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	req := &http.Request{
+		Method: http.MethodGet,
+		URL:    u,
+		Host:   u.Host,
+		Header: http.Header{
+			"Upgrade":               {"websocket"},
+			"Connection":            {"Upgrade"},
+			"Sec-WebSocket-Key":     {key},
+			"Sec-WebSocket-Version": {"13"},
+		},
+	}
+	if err = req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		conn.Close()
+		return nil, fmt.Errorf("%w: status %d", ErrWebSocketHandshake, resp.StatusCode)
+	}
+	return newWebSocketConn(conn, reader, true), nil
+}
+
+// ReadMessage returns the next text or binary message, control frames are handled
+// internally. io.EOF is returned once the peer has closed the connection.
+func (c *WebSocketConn) ReadMessage() (int, []byte, error) {
+	var messageType int
+	var data []byte
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch opcode {
+		case PingMessage:
+			if err = c.writeFrame(PongMessage, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case PongMessage:
+			continue
+		case CloseMessage:
+			c.writeFrame(CloseMessage, payload)
+			c.close()
+			return 0, nil, io.EOF
+		case TextMessage, BinaryMessage:
+			if messageType != 0 {
+				return 0, nil, ErrWebSocketProtocol
+			}
+			messageType = opcode
+		case 0:
+			if messageType == 0 {
+				return 0, nil, ErrWebSocketProtocol
+			}
+		default:
+			return 0, nil, ErrWebSocketProtocol
+		}
+
+		if len(data)+len(payload) > webSocketMaxMessageSize {
+			return 0, nil, ErrWebSocketMessageSize
+		}
+		data = append(data, payload...)
+		if fin {
+			return messageType, data, nil
+		}
+	}
+}
+
+func (c *WebSocketConn) WriteMessage(messageType int, data []byte) error {
+	if messageType != TextMessage && messageType != BinaryMessage {
+		return ErrWebSocketProtocol
+	}
+	return c.writeFrame(messageType, data)
+}
+
+// Close performs the closing handshake from this side.
+func (c *WebSocketConn) Close() error {
+	c.writeFrame(CloseMessage, nil)
+	return c.close()
+}
+
+func (c *WebSocketConn) close() error {
+	var err error
+	c.once.Do(func() {
+		err = c.conn.Close()
+	})
+	return err
+}
+
+func (c *WebSocketConn) readFrame() (bool, int, []byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(c.reader, header); err != nil {
+		return false, 0, nil, err
+	}
+	fin := header[0]&0x80 != 0
+	opcode := int(header[0] & 0x0f)
+	masked := header[1]&0x80 != 0
+	size := uint64(header[1] & 0x7f)
+
+	if header[0]&0x70 != 0 || masked == c.client {
+		return false, 0, nil, ErrWebSocketProtocol
+	}
+
+	switch size {
+	case 126:
+		ext := make([]byte, 2)
+		if _, err := io.ReadFull(c.reader, ext); err != nil {
+			return false, 0, nil, err
+		}
+		size = uint64(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		if _, err := io.ReadFull(c.reader, ext); err != nil {
+			return false, 0, nil, err
+		}
+		size = binary.BigEndian.Uint64(ext)
+	}
+	if opcode >= CloseMessage && (!fin || size > webSocketMaxControlSize) {
+		return false, 0, nil, ErrWebSocketProtocol
+	}
+	if size > webSocketMaxMessageSize {
+		return false, 0, nil, ErrWebSocketMessageSize
+	}
+
+	var mask []byte
+	if masked {
+		mask = make([]byte, 4)
+		if _, err := io.ReadFull(c.reader, mask); err != nil {
+			return false, 0, nil, err
+		}
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for index := range payload {
+			payload[index] ^= mask[index%4]
+		}
+	}
+	return fin, opcode, payload, nil
+}
+
+func (c *WebSocketConn) writeFrame(opcode int, payload []byte) error {
+	frame := []byte{0x80 | byte(opcode), 0}
+	size := len(payload)
+	switch {
+	case size < 126:
+		frame[1] = byte(size)
+	case size <= 0xffff:
+		frame[1] = 126
+		frame = binary.BigEndian.AppendUint16(frame, uint16(size))
+	default:
+		frame[1] = 127
+		frame = binary.BigEndian.AppendUint64(frame, uint64(size))
+	}
+
+	if c.client {
+		frame[1] |= 0x80
+		mask := make([]byte, 4)
+		rand.Read(mask)
+		frame = append(frame, mask...)
+		start := len(frame)
+		frame = append(frame, payload...)
+		for index := start; index < len(frame); index++ {
+			frame[index] ^= mask[(index-start)%4]
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+
+	c.wMutex.Lock()
+	defer c.wMutex.Unlock()
+
+	if _, err := c.conn.Write(frame); err != nil {
+		return ErrWebSocketClosed
+	}
+	return nil
+}
+
+func acceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + webSocketGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func headerContains(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, v := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(v), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
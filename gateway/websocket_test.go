@@ -0,0 +1,243 @@
+package gateway_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/acoderup/boost/device"
+	"github.com/acoderup/boost/encoding"
+	"github.com/acoderup/boost/gateway"
+	"github.com/acoderup/boost/magic"
+	"github.com/acoderup/boost/message"
+	"github.com/acoderup/boost/route"
+	"github.com/acoderup/boost/style"
+)
+
+func readMessage(t *testing.T, conn *gateway.WebSocketConn) *message.Message {
+	messageType, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("unexpected error reading: %v", err)
+	}
+	if messageType != gateway.BinaryMessage {
+		t.Fatalf("expecting binary message, got %d: %s", messageType, data)
+	}
+	msg, err := message.Unmarshal(data)
+	if err != nil {
+		t.Fatalf("unexpected error unmarshaling: %v", err)
+	}
+	return msg
+}
+
+func TestWebSocket(t *testing.T) {
+	router := device.NewRouter(magic.Server).Integrate(&Try{})
+	bus := device.NewBus().Integrate(router)
+	ws := gateway.NewWebSocket(router)
+	server := httptest.NewServer(ws)
+	defer server.Close()
+
+	ctx := context.Background()
+	conn, err := gateway.DialWebSocket(ctx, "ws"+strings.TrimPrefix(server.URL, "http"))
+	if err != nil {
+		t.Fatalf("unexpected error dialing: %v", err)
+	}
+
+	e := encoding.NewJSON()
+	data, err := message.Marshal(&message.Message{
+		ID:       7,
+		Route:    route.NewChainRoute(nil, style.GoogleChain("/server/echo")),
+		Encoding: e,
+		Data:     encoding.Encode(e, &Ping{Text: strings.Repeat("long ", 100)}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.WriteMessage(gateway.BinaryMessage, data); err != nil {
+		t.Fatalf("unexpected error writing: %v", err)
+	}
+
+	resp := readMessage(t, conn)
+	pong := &Pong{}
+	encoding.Decode(e, resp.Data, pong)
+	if resp.ID != 7 || pong.Text != strings.Repeat("long ", 100) {
+		t.Fatalf("unexpected response %d %+v", resp.ID, pong)
+	}
+
+	names := ws.Sessions()
+	if len(names) != 1 {
+		t.Fatalf("expecting 1 session, got %v", names)
+	}
+	session, _ := ws.Session(names[0])
+	err = router.Process(ctx, &message.Message{
+		ID:       100,
+		Route:    route.NewChainRoute(device.Addr(router), device.Addr(session)),
+		Encoding: e,
+		Data:     encoding.Encode(e, &Pong{Text: "push"}),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error pushing: %v", err)
+	}
+	push := readMessage(t, conn)
+	encoding.Decode(e, push.Data, pong)
+	if push.ID != 100 || pong.Text != "push" {
+		t.Fatalf("unexpected push %d %+v", push.ID, pong)
+	}
+
+	conn.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(ws.Sessions()) != 0 || bus.Locate(names[0]) != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout when waiting for the session to detach")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWebSocketConfined(t *testing.T) {
+	router := device.NewRouter(magic.Server).Integrate(&Try{})
+	ws := gateway.NewWebSocket(router)
+	server := httptest.NewServer(ws)
+	defer server.Close()
+
+	dial := func(sessions int) (*gateway.WebSocketConn, string) {
+		previous := ws.Sessions()
+		conn, err := gateway.DialWebSocket(context.Background(), "ws"+strings.TrimPrefix(server.URL, "http"))
+		if err != nil {
+			t.Fatalf("unexpected error dialing: %v", err)
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for len(ws.Sessions()) != sessions {
+			if time.Now().After(deadline) {
+				t.Fatal("timeout when waiting for the session")
+			}
+			time.Sleep(time.Millisecond)
+		}
+		for _, name := range ws.Sessions() {
+			if !slices.Contains(previous, name) {
+				return conn, name
+			}
+		}
+		return conn, ""
+	}
+	e := encoding.NewJSON()
+	send := func(conn *gateway.WebSocketConn, path []string, text string) {
+		data, _ := message.Marshal(&message.Message{
+			ID:       1,
+			Route:    route.NewChainRoute(nil, path),
+			Encoding: e,
+			Data:     encoding.Encode(e, &Pong{Text: text}),
+		})
+		if err := conn.WriteMessage(gateway.BinaryMessage, data); err != nil {
+			t.Fatalf("unexpected error writing: %v", err)
+		}
+	}
+
+	attacker, _ := dial(1)
+	defer attacker.Close()
+	victim, name := dial(2)
+	defer victim.Close()
+
+	send(attacker, []string{"", name}, "spoofed")
+	messageType, data, err := attacker.ReadMessage()
+	if err != nil || messageType != gateway.TextMessage || !strings.Contains(string(data), gateway.ErrRouteOutOfScope.Error()) {
+		t.Fatalf("expecting the route to be rejected, got %d %s: %v", messageType, data, err)
+	}
+
+	// The first message of the victim is the reply to its own request
+	send(victim, style.GoogleChain("/server/echo"), "own")
+	pong := &Pong{}
+	encoding.Decode(e, readMessage(t, victim).Data, pong)
+	if pong.Text != "own" {
+		t.Fatalf("expecting the reply to the victim, got %+v", pong)
+	}
+}
+
+type Meta struct{}
+
+func (*Meta) Keys(ctx context.Context, _ *Ping) (*Pong, error) {
+	var keys []string
+	for key := range device.RequestFrom(ctx).Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return &Pong{Text: strings.Join(keys, ",")}, nil
+}
+
+func TestWebSocketGateways(t *testing.T) {
+	router := device.NewRouter(magic.Server).Integrate(&Try{}, &Meta{})
+	device.NewBus().Integrate(router)
+	e := encoding.NewJSON()
+
+	var conns []*gateway.WebSocketConn
+	for range 2 {
+		server := httptest.NewServer(gateway.NewWebSocket(router))
+		defer server.Close()
+		conn, err := gateway.DialWebSocket(context.Background(), "ws"+strings.TrimPrefix(server.URL, "http"))
+		if err != nil {
+			t.Fatalf("unexpected error dialing: %v", err)
+		}
+		defer conn.Close()
+		conns = append(conns, conn)
+	}
+
+	// Sessions of gateways sharing a bus get their own replies, and only the metadata
+	// HTTP accepts from headers is kept
+	for index, conn := range conns {
+		md := message.Metadata{message.MetadataLocale: "en", "role": "admin"}
+		data, _ := message.Marshal(&message.Message{
+			ID:       uint64(index + 1),
+			Route:    route.NewChainRoute(nil, style.GoogleChain("/server/keys")),
+			Encoding: e,
+			Metadata: md,
+			Data:     encoding.Encode(e, &Ping{Text: "keys"}),
+		})
+		if err := conn.WriteMessage(gateway.BinaryMessage, data); err != nil {
+			t.Fatalf("unexpected error writing: %v", err)
+		}
+	}
+	for index, conn := range conns {
+		resp := readMessage(t, conn)
+		pong := &Pong{}
+		encoding.Decode(e, resp.Data, pong)
+		keys := strings.Split(pong.Text, ",")
+		if resp.ID != uint64(index+1) || !slices.Contains(keys, "locale") || slices.Contains(keys, "role") {
+			t.Fatalf("unexpected reply %d %+v", resp.ID, pong)
+		}
+	}
+}
+
+func TestWebSocketOrigin(t *testing.T) {
+	router := device.NewRouter(magic.Server).Integrate(&Try{})
+	cases := []struct {
+		opts   []gateway.Option
+		origin string
+		status int
+	}{
+		{nil, "http://evil.example", http.StatusForbidden},
+		{[]gateway.Option{gateway.WithOrigins("http://game.example")}, "http://evil.example", http.StatusForbidden},
+		{[]gateway.Option{gateway.WithOrigins("http://game.example")}, "http://game.example", http.StatusSwitchingProtocols},
+	}
+	for _, c := range cases {
+		server := httptest.NewServer(gateway.NewWebSocket(router, c.opts...))
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", "websocket")
+		req.Header.Set("Sec-WebSocket-Version", "13")
+		req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+		req.Header.Set("Origin", c.origin)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+		server.Close()
+		if resp.StatusCode != c.status {
+			t.Fatalf("expecting status %d from %s, got %d", c.status, c.origin, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package httpx
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/acoderup/boost/metrics"
+)
+
+type metricsTransport struct {
+	next     http.RoundTripper
+	requests metrics.Counter
+	errors   metrics.Counter
+	inflight metrics.Gauge
+	duration metrics.Histogram
+}
+
+// Metrics records the requests, errors, in-flight requests and latency of the client
+// into r, labeled by method and host. Requests are labeled by status code too, or by
+// "error" when no response is received.
+func (c *Client) Metrics(r *metrics.Registry) *Client {
+	next := c.Client.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	c.Client.Transport = &metricsTransport{
+		next:     next,
+		requests: r.Counter("boost_httpx_requests_total", "Requests sent by the client, by status code or error.", "method", "host", "code"),
+		errors:   r.Counter("boost_httpx_errors_total", "Requests failed without a response.", "method", "host"),
+		inflight: r.Gauge("boost_httpx_inflight", "Requests waiting for a response.", "method", "host"),
+		duration: r.Histogram("boost_httpx_duration_seconds", "Time until the response headers.", nil, "method", "host"),
+	}
+	return c
+}
+
+func (t *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	method, host := req.Method, req.URL.Host
+	t.inflight.Add(1, method, host)
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	t.duration.Observe(time.Since(start).Seconds(), method, host)
+	t.inflight.Add(-1, method, host)
+
+	if err != nil {
+		t.requests.Inc(method, host, "error")
+		t.errors.Inc(method, host)
+		return resp, err
+	}
+	t.requests.Inc(method, host, strconv.Itoa(resp.StatusCode))
+	return resp, nil
+}
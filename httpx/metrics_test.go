@@ -0,0 +1,57 @@
+package httpx_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/acoderup/boost/httpx"
+	"github.com/acoderup/boost/metrics"
+)
+
+func TestClientMetrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	r := metrics.NewRegistry()
+	client := httpx.NewClient(httpx.DefaultClientConfig).Metrics(r)
+	for _, path := range []string{"/", "/", "/missing"} {
+		client.Request(func(c *http.Client) (*http.Response, error) {
+			return c.Get(server.URL + path)
+		})
+	}
+
+	host := mustHost(t, server.URL)
+	requests := r.Counter("boost_httpx_requests_total", "", "method", "host", "code")
+	if n := requests.Value("GET", host, "200"); n != 2 {
+		t.Fatalf("expecting 2 requests, got %v", n)
+	}
+	if n := requests.Value("GET", host, "404"); n != 1 {
+		t.Fatalf("expecting 1 request, got %v", n)
+	}
+	if n := r.Histogram("boost_httpx_duration_seconds", "", nil, "method", "host").Count("GET", host); n != 3 {
+		t.Fatalf("expecting 3 observations, got %v", n)
+	}
+
+	// Requests failing without a response are counted too
+	server.Close()
+	client.Request(func(c *http.Client) (*http.Response, error) {
+		return c.Get(server.URL + "/")
+	})
+	if n := requests.Value("GET", host, "error"); n != 1 {
+		t.Fatalf("expecting 1 failed request, got %v", n)
+	}
+}
+
+func mustHost(t *testing.T, rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Host
+}
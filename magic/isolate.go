@@ -10,4 +10,5 @@ const (
 	Server    = "Server"
 	Client    = "Client"
 	Bus       = "Bus"
+	Gateway   = "Gateway"
 )
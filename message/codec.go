@@ -0,0 +1,334 @@
+package message
+
+import (
+	"encoding/binary"
+	"errors"
+	"maps"
+	"math"
+	"slices"
+
+	"github.com/acoderup/boost/encoding"
+	"github.com/acoderup/boost/route"
+)
+
+var (
+	ErrCodecUnknownVersion      = errors.New("message codec meets an unknown version")
+	ErrCodecMalformed           = errors.New("message codec meets malformed data")
+	ErrCodecUnsupportedRoute    = errors.New("message codec only supports chain route")
+	ErrCodecUnsupportedEncoding = errors.New("message codec only supports registered or chain encoding")
+)
+
+// CodecVersion is the version of the binary envelope written by Marshal, Unmarshal
+// still reads envelopes of earlier versions.
+//
+// Envelope layout, integers are uvarints and strings are length-prefixed:
+//
+//	version | id | route kind [src | dst | index | hops | hop limit] | encoding kind [name | encoder | decoder] | metadata | data
+//
+// Path routes are followed by their raw segments and parameters after the hop limit.
+// Version 1 has no metadata, and versions before 3 have no hops nor path routes.
+const CodecVersion byte = 3
+
+// The first versions carrying each feature of the envelope.
+const (
+	codecVersionMetadata byte = 2
+	codecVersionHops     byte = 3
+)
+
+const (
+	kindNil byte = iota
+	kindChainRoute
+	kindNamedEncoding
+	kindChainEncoding
+	kindPathRoute
+)
+
+func Marshal(msg *Message) ([]byte, error) {
+	data := []byte{CodecVersion}
+	data = binary.AppendUvarint(data, msg.ID)
+
+	switch r := msg.Route.(type) {
+	case nil:
+		data = append(data, kindNil)
+	case route.ChainRoute:
+		data = appendChainRoute(data, r)
+	case *route.ChainRoute:
+		data = appendChainRoute(data, *r)
+	case route.PathRoute:
+		data = appendPathRoute(data, r)
+	case *route.PathRoute:
+		data = appendPathRoute(data, *r)
+	default:
+		return nil, ErrCodecUnsupportedRoute
+	}
+
+	switch e := msg.Encoding.(type) {
+	case nil:
+		data = append(data, kindNil)
+	case encoding.ChainEncoding:
+		data = appendChainEncoding(data, e)
+	case *encoding.ChainEncoding:
+		data = appendChainEncoding(data, *e)
+	default:
+		name := e.String()
+		if _, err := encoding.LocateEncoding(name); err != nil {
+			return nil, ErrCodecUnsupportedEncoding
+		}
+		data = append(data, kindNamedEncoding)
+		data = appendString(data, name)
+	}
+
+	data = binary.AppendUvarint(data, uint64(len(msg.Metadata)))
+	for _, key := range slices.Sorted(maps.Keys(msg.Metadata)) {
+		data = appendString(data, key)
+		data = appendString(data, msg.Metadata[key])
+	}
+
+	data = appendBytes(data, msg.Data)
+	return data, nil
+}
+
+func Unmarshal(data []byte) (*Message, error) {
+	if len(data) == 0 {
+		return nil, ErrCodecMalformed
+	}
+	version := data[0]
+	if version == 0 || version > CodecVersion {
+		return nil, ErrCodecUnknownVersion
+	}
+
+	r := &reader{data: data[1:]}
+	msg := &Message{
+		ID: r.uvarint(),
+	}
+
+	switch r.byte() {
+	case kindNil:
+	case kindChainRoute:
+		src := r.strings()
+		dst := r.strings()
+		index := r.uvarint()
+		if r.err == nil && index >= uint64(len(dst)) {
+			return nil, ErrCodecMalformed
+		}
+		cr := route.MakeChainRoute(src, dst, int(index))
+		if version >= codecVersionHops {
+			cr = cr.WithHops(r.int()).WithHopLimit(r.int())
+		}
+		msg.Route = cr
+	case kindPathRoute:
+		if version < codecVersionHops {
+			r.fail()
+			break
+		}
+		src := r.strings()
+		dst := r.strings()
+		index, hops, limit := r.uvarint(), r.int(), r.int()
+		raw := r.strings()
+		var params map[string]string
+		if size := r.uvarint(); size > 0 && r.err == nil {
+			if size > uint64(len(r.data)) {
+				r.fail()
+				break
+			}
+			params = make(map[string]string, size)
+			for index := uint64(0); index < size && r.err == nil; index++ {
+				key := string(r.bytes())
+				params[key] = string(r.bytes())
+			}
+		}
+		if r.err == nil && (index >= uint64(len(dst)) || len(raw) != len(dst)) {
+			return nil, ErrCodecMalformed
+		}
+		msg.Route = route.MakePathRoute(src, dst, raw, int(index), params).WithHops(hops).WithHopLimit(limit)
+	default:
+		r.fail()
+	}
+
+	switch r.byte() {
+	case kindNil:
+	case kindNamedEncoding:
+		name := string(r.bytes())
+		if r.err != nil {
+			break
+		}
+		e, err := encoding.LocateEncoding(name)
+		if err != nil {
+			return nil, err
+		}
+		msg.Encoding = e
+	case kindChainEncoding:
+		encoder := r.strings()
+		decoder := r.strings()
+		if r.err != nil {
+			break
+		}
+		for _, name := range append(encoder[:len(encoder):len(encoder)], decoder...) {
+			if _, err := encoding.LocateEncoding(name); err != nil {
+				return nil, err
+			}
+		}
+		msg.Encoding = encoding.NewChainEncoding(encoder, decoder)
+	default:
+		r.fail()
+	}
+
+	if version >= codecVersionMetadata {
+		size := r.uvarint()
+		if r.err == nil && size > uint64(len(r.data)) {
+			r.fail()
+		}
+		for index := uint64(0); index < size && r.err == nil; index++ {
+			key := string(r.bytes())
+			msg.Metadata.Set(key, string(r.bytes()))
+		}
+	}
+
+	msg.Data = r.bytes()
+	if r.err != nil {
+		return nil, r.err
+	}
+	if len(r.data) != 0 {
+		return nil, ErrCodecMalformed
+	}
+	return msg, nil
+}
+
+func appendChainRoute(data []byte, r route.ChainRoute) []byte {
+	data = append(data, kindChainRoute)
+	data = appendStrings(data, r.Src())
+	data = appendStrings(data, r.Dst())
+	data = binary.AppendUvarint(data, uint64(r.Index()))
+	data = binary.AppendUvarint(data, uint64(r.Hops()))
+	return binary.AppendUvarint(data, uint64(hopLimit(r.HopLimit())))
+}
+
+func appendPathRoute(data []byte, r route.PathRoute) []byte {
+	data = append(data, kindPathRoute)
+	data = appendStrings(data, r.Src())
+	data = appendStrings(data, r.Dst())
+	data = binary.AppendUvarint(data, uint64(r.Index()))
+	data = binary.AppendUvarint(data, uint64(r.Hops()))
+	data = binary.AppendUvarint(data, uint64(hopLimit(r.HopLimit())))
+	data = appendStrings(data, r.Raw())
+	params := r.Params()
+	data = binary.AppendUvarint(data, uint64(len(params)))
+	for _, key := range slices.Sorted(maps.Keys(params)) {
+		data = appendString(data, key)
+		data = appendString(data, params[key])
+	}
+	return data
+}
+
+// hopLimit keeps the limit as set, so 0 still means the default of the receiver.
+func hopLimit(limit int) int {
+	if limit == route.DefaultHopLimit {
+		return 0
+	}
+	return limit
+}
+
+func appendChainEncoding(data []byte, e encoding.ChainEncoding) []byte {
+	data = append(data, kindChainEncoding)
+	data = appendStrings(data, e.Encoder())
+	return appendStrings(data, e.Decoder())
+}
+
+func appendBytes(data []byte, b []byte) []byte {
+	data = binary.AppendUvarint(data, uint64(len(b)))
+	return append(data, b...)
+}
+
+func appendString(data []byte, s string) []byte {
+	data = binary.AppendUvarint(data, uint64(len(s)))
+	return append(data, s...)
+}
+
+func appendStrings(data []byte, ss []string) []byte {
+	data = binary.AppendUvarint(data, uint64(len(ss)))
+	for _, s := range ss {
+		data = appendString(data, s)
+	}
+	return data
+}
+
+type reader struct {
+	data []byte
+	err  error
+}
+
+func (r *reader) fail() {
+	if r.err == nil {
+		r.err = ErrCodecMalformed
+	}
+}
+
+func (r *reader) byte() byte {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.data) == 0 {
+		r.fail()
+		return 0
+	}
+	b := r.data[0]
+	r.data = r.data[1:]
+	return b
+}
+
+func (r *reader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.fail()
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+// int reads a count such as hops, which must fit in an int32 on any platform.
+func (r *reader) int() int {
+	v := r.uvarint()
+	if v > math.MaxInt32 {
+		r.fail()
+		return 0
+	}
+	return int(v)
+}
+
+func (r *reader) bytes() []byte {
+	size := r.uvarint()
+	if r.err != nil {
+		return nil
+	}
+	if size > uint64(len(r.data)) {
+		r.fail()
+		return nil
+	}
+	if size == 0 {
+		return nil
+	}
+	b := make([]byte, size)
+	copy(b, r.data)
+	r.data = r.data[size:]
+	return b
+}
+
+func (r *reader) strings() []string {
+	size := r.uvarint()
+	if r.err != nil {
+		return nil
+	}
+	if size > uint64(len(r.data)) {
+		r.fail()
+		return nil
+	}
+	ss := make([]string, 0, size)
+	for index := uint64(0); index < size; index++ {
+		ss = append(ss, string(r.bytes()))
+	}
+	return ss
+}
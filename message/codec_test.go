@@ -0,0 +1,202 @@
+package message_test
+
+import (
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/acoderup/boost/encoding"
+	"github.com/acoderup/boost/message"
+	"github.com/acoderup/boost/route"
+	"github.com/acoderup/boost/style"
+)
+
+func TestCodec(t *testing.T) {
+	type Ping struct {
+		Text string
+	}
+
+	e := encoding.NewChainEncoding([]string{"JSON", "Base64"}, []string{"Base64", "JSON"})
+	data, err := encoding.Marshal(e, &Ping{Text: "libra: Hello, world!"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := route.NewChainRoute(style.GoogleChain("/anonymous"), style.GoogleChain("/1.0.0/try/echo")).Forward()
+	msg1 := &message.Message{
+		ID:       42,
+		Route:    r,
+		Encoding: e,
+		Data:     data,
+	}
+
+	envelope, err := message.Marshal(msg1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg2, err := message.Unmarshal(envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("msg2: %v %v %v", msg2.ID, msg2.Route, msg2.Encoding)
+
+	if msg2.ID != msg1.ID {
+		t.Fatalf("expecting id %d, got %d", msg1.ID, msg2.ID)
+	}
+	if msg2.Route.String() != msg1.Route.String() {
+		t.Fatalf("expecting route %v, got %v", msg1.Route, msg2.Route)
+	}
+	if msg2.Route.Position() != "1.0.0" {
+		t.Fatalf("expecting position 1.0.0, got %s", msg2.Route.Position())
+	}
+	if msg2.Encoding.String() != msg1.Encoding.String() {
+		t.Fatalf("expecting encoding %v, got %v", msg1.Encoding, msg2.Encoding)
+	}
+	ping := &Ping{}
+	if err = encoding.Unmarshal(msg2.Encoding.Reverse(), msg2.Data, ping); err != nil {
+		t.Fatal(err)
+	}
+	if ping.Text != "libra: Hello, world!" {
+		t.Fatalf("unexpected ping %+v", ping)
+	}
+
+	msg3 := &message.Message{ID: 7, Route: r.Reverse(), Encoding: encoding.NewJSON()}
+	envelope, err = message.Marshal(msg3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg4, err := message.Unmarshal(envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(msg3.Route, msg4.Route) || msg4.Encoding.String() != "JSON" {
+		t.Fatalf("expecting %+v, got %+v", msg3, msg4)
+	}
+}
+
+func TestCodecError(t *testing.T) {
+	envelope, err := message.Marshal(&message.Message{Encoding: encoding.NewJSON(), Data: []byte("{}")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = message.Unmarshal(append([]byte{0}, envelope[1:]...)); !errors.Is(err, message.ErrCodecUnknownVersion) {
+		t.Fatalf("expecting unknown version error, got %v", err)
+	}
+	if _, err = message.Unmarshal(envelope[:len(envelope)-1]); !errors.Is(err, message.ErrCodecMalformed) {
+		t.Fatalf("expecting malformed error, got %v", err)
+	}
+
+	e := encoding.NewChainEncoding([]string{"Missing"}, []string{"JSON"})
+	envelope, err = message.Marshal(&message.Message{Encoding: e})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = message.Unmarshal(envelope); !errors.Is(err, encoding.ErrEncodingMissingEncoding) {
+		t.Fatalf("expecting missing encoding error, got %v", err)
+	}
+}
+
+func TestCodecMetadata(t *testing.T) {
+	msg1 := &message.Message{
+		ID:       1,
+		Encoding: encoding.NewJSON(),
+		Metadata: message.Metadata{
+			message.MetadataTraceID: "trace",
+			message.MetadataLocale:  "zh-CN",
+		},
+		Data: []byte("{}"),
+	}
+	envelope, err := message.Marshal(msg1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg2, err := message.Unmarshal(envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(msg1.Metadata, msg2.Metadata) {
+		t.Fatalf("expecting metadata %v, got %v", msg1.Metadata, msg2.Metadata)
+	}
+
+	// Version 1 envelope of the same message without metadata
+	v1 := []byte{1, 1, 0, 2, 4, 'J', 'S', 'O', 'N', 2, '{', '}'}
+	msg3, err := message.Unmarshal(v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg3.Metadata != nil || string(msg3.Data) != "{}" || msg3.Encoding.String() != "JSON" {
+		t.Fatalf("unexpected version 1 message %+v", msg3)
+	}
+}
+
+func TestCodecHops(t *testing.T) {
+	r, _ := route.NewChainRoute([]string{"Bus", "Client"}, []string{"", "Room"}).WithHopLimit(8).Forward().(route.ChainRoute).Hop()
+	msg1 := &message.Message{ID: 1, Route: r, Encoding: encoding.NewJSON()}
+	envelope, err := message.Marshal(msg1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg2, err := message.Unmarshal(envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cr := msg2.Route.(route.ChainRoute); cr.Hops() != 1 || cr.HopLimit() != 8 {
+		t.Fatalf("expecting 1 of 8 hops, got %d of %d", cr.Hops(), cr.HopLimit())
+	}
+
+	// Version 2 envelope of a route without hops
+	v2 := []byte{2, 1, 1, 2, 3, 'B', 'u', 's', 6, 'C', 'l', 'i', 'e', 'n', 't', 2, 0, 4, 'R', 'o', 'o', 'm', 1, 2, 4, 'J', 'S', 'O', 'N', 0, 0}
+	msg3, err := message.Unmarshal(v2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cr := msg3.Route.(route.ChainRoute); cr.Hops() != 0 || cr.HopLimit() != route.DefaultHopLimit || cr.Position() != "Room" {
+		t.Fatalf("unexpected version 2 route %v", cr)
+	}
+
+	// Hops overflowing an int32 are malformed
+	overflow := binary.AppendUvarint([]byte{3, 1, 1, 0, 1, 0, 0}, 1<<40)
+	overflow = append(overflow, 0, 0, 0, 0)
+	if _, err := message.Unmarshal(overflow); !errors.Is(err, message.ErrCodecMalformed) {
+		t.Fatalf("expecting overflowing hops to be malformed, got %v", err)
+	}
+}
+
+func TestCodecPathRoute(t *testing.T) {
+	p, _ := route.NewPathRoute([]string{"", "Client"}, "/room/Hall-42/join")
+	r := p.WithHopLimit(8).Forward().Forward().(route.PathRoute).Capture("roomID")
+	msg1 := &message.Message{ID: 1, Route: r, Encoding: encoding.NewJSON()}
+	envelope, err := message.Marshal(msg1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg2, err := message.Unmarshal(envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr := msg2.Route.(route.PathRoute)
+	if pr.String() != "/room/Hall-42/join" || pr.Position() != "Hall42" || pr.HopLimit() != 8 ||
+		pr.Params()["roomID"] != "Hall-42" || !reflect.DeepEqual(pr.Src(), []string{"", "Client"}) {
+		t.Fatalf("unexpected path route %v at %s with %v", pr, pr.Position(), pr.Params())
+	}
+}
+
+func TestMetadataReply(t *testing.T) {
+	md := message.Metadata{
+		message.MetadataTraceID: "trace",
+		message.MetadataAuth:    "token",
+		"custom":                "value",
+	}
+	if reply := md.Reply(); !reflect.DeepEqual(reply, message.Metadata{message.MetadataTraceID: "trace"}) {
+		t.Fatalf("unexpected reply metadata %v", reply)
+	}
+
+	message.AddReplyKeys("custom")
+	t.Cleanup(func() {
+		message.RemoveReplyKeys("custom")
+	})
+	if reply := md.Reply(); reply.Get("custom") != "value" || reply.Get(message.MetadataAuth) != "" {
+		t.Fatalf("unexpected reply metadata %v", reply)
+	}
+}
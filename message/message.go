@@ -9,5 +9,6 @@ type Message struct {
 	ID       uint64
 	Route    route.Route
 	Encoding encoding.Encoding
+	Metadata Metadata
 	Data     []byte
 }
@@ -0,0 +1,95 @@
+package message
+
+import "sync"
+
+// Well-known metadata keys.
+const (
+	MetadataTraceID   = "trace-id"
+	MetadataUserID    = "user-id"
+	MetadataSessionID = "session-id"
+	MetadataDeadline  = "deadline"
+	MetadataAuth      = "authorization"
+	MetadataLocale    = "locale"
+	MetadataError     = "error"
+	MetadataStream    = "stream"
+	MetadataSpanID    = "span-id"
+	MetadataVersion   = "version"
+)
+
+// Metadata carries cross-cutting values along with a message through every hop.
+type Metadata map[string]string
+
+var replyKeys = struct {
+	sync.RWMutex
+	keys map[string]struct{}
+}{
+	keys: map[string]struct{}{
+		MetadataTraceID:   {},
+		MetadataUserID:    {},
+		MetadataSessionID: {},
+		MetadataLocale:    {},
+	},
+}
+
+// AddReplyKeys adds keys copied from a request to its response, trace, user,
+// session and locale are copied by default, while credentials and deadlines are not.
+func AddReplyKeys(keys ...string) {
+	replyKeys.Lock()
+	defer replyKeys.Unlock()
+
+	for _, key := range keys {
+		replyKeys.keys[key] = struct{}{}
+	}
+}
+
+// RemoveReplyKeys stops copying keys from requests to their responses, including the
+// keys copied by default.
+func RemoveReplyKeys(keys ...string) {
+	replyKeys.Lock()
+	defer replyKeys.Unlock()
+
+	for _, key := range keys {
+		delete(replyKeys.keys, key)
+	}
+}
+
+func (md Metadata) Get(key string) string {
+	return md[key]
+}
+
+// Set sets the value of key, the metadata is allocated when it is nil.
+func (md *Metadata) Set(key, value string) {
+	if *md == nil {
+		*md = make(Metadata)
+	}
+	(*md)[key] = value
+}
+
+func (md Metadata) Clone() Metadata {
+	if md == nil {
+		return nil
+	}
+	clone := make(Metadata, len(md))
+	for key, value := range md {
+		clone[key] = value
+	}
+	return clone
+}
+
+// Reply returns the metadata of the response to a request carrying md.
+func (md Metadata) Reply() Metadata {
+	replyKeys.RLock()
+	defer replyKeys.RUnlock()
+
+	var reply Metadata
+	for key, value := range md {
+		if _, ok := replyKeys.keys[key]; !ok {
+			continue
+		}
+		if reply == nil {
+			reply = make(Metadata)
+		}
+		reply[key] = value
+	}
+	return reply
+}
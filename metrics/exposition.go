@@ -0,0 +1,134 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// ContentType is the content type of the Prometheus text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var _ http.Handler = (*Registry)(nil)
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	r.WriteTo(w)
+}
+
+// WriteTo renders every metric in the Prometheus text exposition format, sorted by
+// name and label values.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.rwMutex.RLock()
+	vecs := make([]*vec, 0, len(r.metrics))
+	for _, v := range r.metrics {
+		vecs = append(vecs, v)
+	}
+	r.rwMutex.RUnlock()
+	sort.Slice(vecs, func(i, j int) bool {
+		return vecs[i].name < vecs[j].name
+	})
+
+	cw := &countWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, v := range vecs {
+		v.write(bw)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+func (v *vec) write(w *bufio.Writer) {
+	v.rwMutex.RLock()
+	series := make([]*series, 0, len(v.series))
+	for _, s := range v.series {
+		series = append(series, s)
+	}
+	v.rwMutex.RUnlock()
+	sort.Slice(series, func(i, j int) bool {
+		return strings.Join(series[i].values, "\xff") < strings.Join(series[j].values, "\xff")
+	})
+
+	if v.help != "" {
+		w.WriteString("# HELP " + v.name + " " + escapeHelp(v.help) + "\n")
+	}
+	w.WriteString("# TYPE " + v.name + " " + string(v.kind) + "\n")
+	for _, s := range series {
+		if v.kind != kindHistogram {
+			writeSample(w, v.name, v.labels, s.values, "", "", s.load())
+			continue
+		}
+
+		var cumulative uint64
+		for index, bound := range v.buckets {
+			cumulative += atomic.LoadUint64(&s.counts[index])
+			writeSample(w, v.name+"_bucket", v.labels, s.values, "le", formatFloat(bound), float64(cumulative))
+		}
+		count := atomic.LoadUint64(&s.count)
+		writeSample(w, v.name+"_bucket", v.labels, s.values, "le", "+Inf", float64(count))
+		writeSample(w, v.name+"_sum", v.labels, s.values, "", "", s.load())
+		writeSample(w, v.name+"_count", v.labels, s.values, "", "", float64(count))
+	}
+}
+
+func writeSample(w *bufio.Writer, name string, labels, values []string, extraLabel, extraValue string, value float64) {
+	w.WriteString(name)
+	if len(labels) > 0 || extraLabel != "" {
+		w.WriteByte('{')
+		for index, label := range labels {
+			if index > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(label + `="` + escapeLabel(values[index]) + `"`)
+		}
+		if extraLabel != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(extraLabel + `="` + extraValue + `"`)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var helpReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+var labelReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeHelp(s string) string {
+	return helpReplacer.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelReplacer.Replace(s)
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
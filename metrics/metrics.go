@@ -0,0 +1,229 @@
+package metrics
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultBuckets are the upper bounds in seconds of latency histograms.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type kind string
+
+const (
+	kindCounter   kind = "counter"
+	kindGauge     kind = "gauge"
+	kindHistogram kind = "histogram"
+)
+
+// Registry holds metrics by name and renders them in the Prometheus text format.
+type Registry struct {
+	rwMutex sync.RWMutex
+	metrics map[string]*vec
+}
+
+var defaultRegistry = NewRegistry()
+
+func Default() *Registry {
+	return defaultRegistry
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		metrics: make(map[string]*vec),
+	}
+}
+
+// vec is a metric with a series for every combination of label values.
+type vec struct {
+	name    string
+	help    string
+	kind    kind
+	labels  []string
+	buckets []float64
+	rwMutex sync.RWMutex
+	series  map[string]*series
+}
+
+type series struct {
+	values []string
+	value  uint64 // float64 bits of counters and gauges, or the sum of histograms
+	count  uint64
+	counts []uint64
+}
+
+type Counter struct {
+	*vec
+}
+
+type Gauge struct {
+	*vec
+}
+
+type Histogram struct {
+	*vec
+}
+
+// Counter returns the counter called name, registering it at the first call.
+func (r *Registry) Counter(name, help string, labels ...string) Counter {
+	return Counter{r.register(name, help, kindCounter, nil, labels)}
+}
+
+// Gauge returns the gauge called name, registering it at the first call.
+func (r *Registry) Gauge(name, help string, labels ...string) Gauge {
+	return Gauge{r.register(name, help, kindGauge, nil, labels)}
+}
+
+// Histogram returns the histogram called name, registering it at the first call,
+// DefaultBuckets are used when buckets is nil.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) Histogram {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	return Histogram{r.register(name, help, kindHistogram, buckets, labels)}
+}
+
+// Value returns the value of a counter or gauge series without registering anything,
+// it reports false when no such metric is registered with as many labels as values.
+func (r *Registry) Value(name string, values ...string) (float64, bool) {
+	r.rwMutex.RLock()
+	v, ok := r.metrics[name]
+	r.rwMutex.RUnlock()
+	if !ok || v.kind == kindHistogram || len(v.labels) != len(values) {
+		return 0, false
+	}
+	if s, ok := v.lookup(values); ok {
+		return s.load(), true
+	}
+	return 0, true
+}
+
+func (r *Registry) register(name, help string, k kind, buckets []float64, labels []string) *vec {
+	r.rwMutex.RLock()
+	v, ok := r.metrics[name]
+	r.rwMutex.RUnlock()
+	if !ok {
+		r.rwMutex.Lock()
+		if v, ok = r.metrics[name]; !ok {
+			v = &vec{
+				name:    name,
+				help:    help,
+				kind:    k,
+				labels:  labels,
+				buckets: append([]float64(nil), buckets...),
+				series:  make(map[string]*series),
+			}
+			sort.Float64s(v.buckets)
+			r.metrics[name] = v
+		}
+		r.rwMutex.Unlock()
+	}
+	if v.kind != k || len(v.labels) != len(labels) {
+		log.Panicf("metric %s is registered as a %s with labels %v", name, v.kind, v.labels)
+	}
+	return v
+}
+
+func (v *vec) with(values []string) *series {
+	if len(values) != len(v.labels) {
+		log.Panicf("metric %s expects %d label values, got %d", v.name, len(v.labels), len(values))
+	}
+	key := strings.Join(values, "\xff")
+
+	v.rwMutex.RLock()
+	s, ok := v.series[key]
+	v.rwMutex.RUnlock()
+	if ok {
+		return s
+	}
+
+	v.rwMutex.Lock()
+	defer v.rwMutex.Unlock()
+	if s, ok = v.series[key]; !ok {
+		s = &series{values: append([]string(nil), values...)}
+		if v.kind == kindHistogram {
+			s.counts = make([]uint64, len(v.buckets))
+		}
+		v.series[key] = s
+	}
+	return s
+}
+
+// lookup returns the series of values without creating it.
+func (v *vec) lookup(values []string) (*series, bool) {
+	v.rwMutex.RLock()
+	defer v.rwMutex.RUnlock()
+
+	s, ok := v.series[strings.Join(values, "\xff")]
+	return s, ok
+}
+
+func (s *series) add(delta float64) {
+	for {
+		old := atomic.LoadUint64(&s.value)
+		if atomic.CompareAndSwapUint64(&s.value, old, math.Float64bits(math.Float64frombits(old)+delta)) {
+			return
+		}
+	}
+}
+
+func (s *series) load() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&s.value))
+}
+
+func (c Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds delta to the counter, which must not be negative.
+func (c Counter) Add(delta float64, values ...string) {
+	if delta < 0 {
+		panic(fmt.Errorf("counter %s cannot decrease", c.name))
+	}
+	c.with(values).add(delta)
+}
+
+// Value returns the value of the counter, 0 for a series never counted.
+func (c Counter) Value(values ...string) float64 {
+	if s, ok := c.lookup(values); ok {
+		return s.load()
+	}
+	return 0
+}
+
+func (g Gauge) Set(value float64, values ...string) {
+	atomic.StoreUint64(&g.with(values).value, math.Float64bits(value))
+}
+
+func (g Gauge) Add(delta float64, values ...string) {
+	g.with(values).add(delta)
+}
+
+func (g Gauge) Value(values ...string) float64 {
+	if s, ok := g.lookup(values); ok {
+		return s.load()
+	}
+	return 0
+}
+
+func (h Histogram) Observe(value float64, values ...string) {
+	s := h.with(values)
+	if index := sort.SearchFloat64s(h.buckets, value); index < len(h.buckets) {
+		atomic.AddUint64(&s.counts[index], 1)
+	}
+	atomic.AddUint64(&s.count, 1)
+	s.add(value)
+}
+
+// Count returns the number of observations.
+func (h Histogram) Count(values ...string) uint64 {
+	if s, ok := h.lookup(values); ok {
+		return atomic.LoadUint64(&s.count)
+	}
+	return 0
+}
@@ -0,0 +1,60 @@
+package metrics_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/acoderup/boost/metrics"
+)
+
+func TestExposition(t *testing.T) {
+	r := metrics.NewRegistry()
+	requests := r.Counter("requests_total", "Requests.\nAll of them.", "route")
+	requests.Inc("/b")
+	requests.Add(2, `/a"`)
+	r.Gauge("inflight", "", "route").Set(3, "/a")
+	latency := r.Histogram("latency_seconds", "Latency.", []float64{1, 0.5})
+	latency.Observe(0.5)
+	latency.Observe(2)
+
+	if r.Counter("requests_total", "", "route").Value("/b") != 1 {
+		t.Fatal("expecting the registered counter")
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := w.Header().Get("Content-Type"); ct != metrics.ContentType {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	expected := strings.Join([]string{
+		`# TYPE inflight gauge`,
+		`inflight{route="/a"} 3`,
+		`# HELP latency_seconds Latency.`,
+		`# TYPE latency_seconds histogram`,
+		`latency_seconds_bucket{le="0.5"} 1`,
+		`latency_seconds_bucket{le="1"} 1`,
+		`latency_seconds_bucket{le="+Inf"} 2`,
+		`latency_seconds_sum 2.5`,
+		`latency_seconds_count 2`,
+		`# HELP requests_total Requests.\nAll of them.`,
+		`# TYPE requests_total counter`,
+		`requests_total{route="/a\""} 2`,
+		`requests_total{route="/b"} 1`,
+		``,
+	}, "\n")
+	if got := w.Body.String(); got != expected {
+		t.Fatalf("unexpected exposition:\n%s\nexpecting:\n%s", got, expected)
+	}
+}
+
+func TestRegistryConflict(t *testing.T) {
+	r := metrics.NewRegistry()
+	r.Counter("conflict", "")
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expecting panic on conflicting registration")
+		}
+	}()
+	r.Gauge("conflict", "")
+}
@@ -0,0 +1,242 @@
+package route
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+
+	"github.com/acoderup/boost/magic"
+	"github.com/acoderup/boost/style"
+)
+
+var (
+	ErrPathMalformed = errors.New("path is malformed")
+)
+
+// Wildcard is the name of a device matching any segment of a path.
+const Wildcard = "*"
+
+// Param returns the parameter name of a device named like "{roomID}", such devices
+// match any segment of a path and capture it under the name.
+func Param(name string) (string, bool) {
+	if len(name) > 2 && strings.HasPrefix(name, "{") && strings.HasSuffix(name, "}") {
+		return name[1 : len(name)-1], true
+	}
+	return "", false
+}
+
+// IsPattern reports whether a device called name matches segments by pattern, that is
+// a parameter or the wildcard.
+func IsPattern(name string) bool {
+	_, ok := Param(name)
+	return ok || name == Wildcard
+}
+
+// PathRoute is a route parsed from a path such as "/server/room/42/join". Segments are
+// standardized into device names, while their raw values are kept for the parameters
+// captured by devices named like "{roomID}".
+type PathRoute struct {
+	src      []string
+	dst      []string
+	raw      []string
+	index    int
+	hops     int
+	hopLimit int
+	params   map[string]string
+}
+
+// ParsePath parses an absolute path, an empty segment is only allowed at the end.
+// Segments naming patterns are rejected, since paths from requests must not address
+// pattern devices directly, see ParsePattern.
+func ParsePath(path string) (PathRoute, error) {
+	return parsePath(path, false)
+}
+
+// ParsePattern parses an absolute path like ParsePath, while segments such as
+// "{roomID}" or "*" address the pattern devices of the name, for routes built by code.
+func ParsePattern(path string) (PathRoute, error) {
+	return parsePath(path, true)
+}
+
+func parsePath(path string, patterns bool) (PathRoute, error) {
+	if !strings.HasPrefix(path, magic.SeparatorSlash) {
+		return PathRoute{}, fmt.Errorf("%w: %q is not absolute", ErrPathMalformed, path)
+	}
+	raw := strings.Split(strings.TrimSuffix(path, magic.SeparatorSlash), magic.SeparatorSlash)
+	dst := make([]string, len(raw))
+	for index, segment := range raw {
+		if index > 0 && segment == "" {
+			return PathRoute{}, fmt.Errorf("%w: %q has an empty segment", ErrPathMalformed, path)
+		}
+		if IsPattern(segment) {
+			if !patterns {
+				return PathRoute{}, fmt.Errorf("%w: %q has a pattern segment %q", ErrPathMalformed, path, segment)
+			}
+			dst[index] = segment
+			continue
+		}
+		dst[index] = style.Standardize(segment, magic.SeparatorHyphen)
+	}
+	return PathRoute{
+		dst: dst,
+		raw: raw,
+	}, nil
+}
+
+// NewPathRoute parses path into a route from src.
+func NewPathRoute(src []string, path string) (*PathRoute, error) {
+	r, err := ParsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	r.src = src
+	return &r, nil
+}
+
+// MakePathRoute builds a route at index of the path, for codecs.
+func MakePathRoute(src, dst, raw []string, index int, params map[string]string) PathRoute {
+	return PathRoute{
+		src:    src,
+		dst:    dst,
+		raw:    raw,
+		index:  index,
+		params: params,
+	}
+}
+
+// From returns the route from src.
+func (r PathRoute) From(src []string) PathRoute {
+	r.src = src
+	return r
+}
+
+// Under returns the route with the path under the devices of prefix, which is an
+// address starting from the bus like the one of a router.
+func (r PathRoute) Under(prefix []string) PathRoute {
+	if len(prefix) <= 1 {
+		return r
+	}
+	dst := append(append([]string{""}, prefix[1:]...), r.dst[1:]...)
+	raw := make([]string, 0, len(dst))
+	raw = append(raw, "")
+	for _, name := range prefix[1:] {
+		raw = append(raw, style.Destandardize(name, magic.SeparatorHyphen))
+	}
+	r.dst, r.raw = dst, append(raw, r.raw[1:]...)
+	return r
+}
+
+func (r PathRoute) Src() []string {
+	return r.src
+}
+
+// Dst returns the standardized device names along the path.
+func (r PathRoute) Dst() []string {
+	return r.dst
+}
+
+func (r PathRoute) Index() int {
+	return r.index
+}
+
+// Raw returns the raw segments along the path.
+func (r PathRoute) Raw() []string {
+	return r.raw
+}
+
+// Segment returns the raw segment at the position.
+func (r PathRoute) Segment() string {
+	return r.raw[r.index]
+}
+
+// Params returns the parameters captured so far.
+func (r PathRoute) Params() map[string]string {
+	return r.params
+}
+
+// Capture returns the route with the raw segment at the position captured as name.
+func (r PathRoute) Capture(name string) Route {
+	params := make(map[string]string, len(r.params)+1)
+	maps.Copy(params, r.params)
+	params[name] = r.raw[r.index]
+	r.params = params
+	return r
+}
+
+// Path returns the path of the route, parsing it gives the same destination.
+func (r PathRoute) Path() string {
+	if len(r.raw) <= 1 {
+		return magic.SeparatorSlash
+	}
+	return strings.Join(r.raw, magic.SeparatorSlash)
+}
+
+func (r PathRoute) String() string {
+	return r.Path()
+}
+
+func (r PathRoute) Dispatching() bool {
+	return r.index > 0
+}
+
+func (r PathRoute) Forward() Route {
+	if r.index < len(r.dst)-1 {
+		r.index++
+	}
+	return r
+}
+
+func (r PathRoute) Position() string {
+	return r.dst[r.index]
+}
+
+// Reverse returns the chain route back to the source.
+func (r PathRoute) Reverse() Route {
+	return ChainRoute{
+		src:      r.dst,
+		dst:      r.src,
+		index:    0,
+		hopLimit: r.hopLimit,
+	}
+}
+
+func (r PathRoute) Error(err error) error {
+	return fmt.Errorf("route %v at %q error: %w", r, r.raw[r.index], err)
+}
+
+func (r PathRoute) Hops() int {
+	return r.hops
+}
+
+func (r PathRoute) HopLimit() int {
+	if r.hopLimit <= 0 {
+		return DefaultHopLimit
+	}
+	return r.hopLimit
+}
+
+func (r PathRoute) WithHopLimit(limit int) PathRoute {
+	r.hopLimit = limit
+	return r
+}
+
+// WithHops returns the route having taken the given number of hops, for codecs.
+func (r PathRoute) WithHops(hops int) PathRoute {
+	r.hops = hops
+	return r
+}
+
+// Hop counts a hop, and reports false once the route has exceeded its hop limit.
+func (r PathRoute) Hop() (Route, bool) {
+	r.hops++
+	return r, r.hops <= r.HopLimit()
+}
+
+// Rewind returns the route back at the source with no hops taken nor parameters.
+func (r PathRoute) Rewind() PathRoute {
+	r.index = 0
+	r.hops = 0
+	r.params = nil
+	return r
+}
@@ -0,0 +1,59 @@
+package route_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/acoderup/boost/route"
+)
+
+func TestPathRoute(t *testing.T) {
+	for _, path := range []string{"/", "/server/room/42/join", "/server/chat-room/{roomID}/*"} {
+		r, err := route.ParsePattern(path)
+		if err != nil {
+			t.Fatalf("unexpected error parsing %q: %v", path, err)
+		}
+		if r.String() != path {
+			t.Fatalf("expecting %q, got %q", path, r.String())
+		}
+		again, err := route.ParsePattern(r.String())
+		if err != nil || !reflect.DeepEqual(again, r) {
+			t.Fatalf("expecting %q to round-trip, got %v: %v", path, again, err)
+		}
+	}
+
+	r, _ := route.ParsePattern("/server/chat-room/{roomID}/*")
+	if !reflect.DeepEqual(r.Dst(), []string{"", "Server", "ChatRoom", "{roomID}", "*"}) {
+		t.Fatalf("unexpected destination %v", r.Dst())
+	}
+
+	for _, path := range []string{"", "server/room", "/server//room", "/server/{roomID}/join", "/server/*"} {
+		if _, err := route.ParsePath(path); !errors.Is(err, route.ErrPathMalformed) {
+			t.Fatalf("expecting %q to be malformed, got %v", path, err)
+		}
+	}
+}
+
+func TestPathRouteCapture(t *testing.T) {
+	p, _ := route.ParsePath("/room/Lobby-42/join")
+	p = p.Under([]string{"Bus", "Server"}).From([]string{"", "Client"})
+	if p.String() != "/server/room/Lobby-42/join" {
+		t.Fatalf("unexpected path %q", p.String())
+	}
+
+	var r route.Route = p
+	for r.Position() != "Lobby42" {
+		r = r.Forward()
+	}
+	captured := r.(route.PathRoute).Capture("roomID").Forward()
+	if params := captured.(route.PathRoute).Params(); params["roomID"] != "Lobby-42" {
+		t.Fatalf("expecting the raw segment to be captured, got %v", params)
+	}
+	if r.(route.PathRoute).Params() != nil {
+		t.Fatal("expecting capture to leave the original route alone")
+	}
+	if reverse := captured.Reverse().(route.ChainRoute); !reflect.DeepEqual(reverse.Dst(), []string{"", "Client"}) {
+		t.Fatalf("expecting the reverse route back to the source, got %v", reverse.Dst())
+	}
+}
@@ -16,10 +16,15 @@ type Route interface {
 	Error(error) error
 }
 
+// DefaultHopLimit is the hop limit of routes without their own.
+var DefaultHopLimit = 64
+
 type ChainRoute struct {
-	src   []string
-	dst   []string
-	index int
+	src      []string
+	dst      []string
+	index    int
+	hops     int
+	hopLimit int
 }
 
 func NewChainRoute(src, dst []string) *ChainRoute {
@@ -29,6 +34,64 @@ func NewChainRoute(src, dst []string) *ChainRoute {
 	}
 }
 
+func MakeChainRoute(src, dst []string, index int) ChainRoute {
+	return ChainRoute{
+		src:   src,
+		dst:   dst,
+		index: index,
+	}
+}
+
+func (r ChainRoute) Src() []string {
+	return r.src
+}
+
+func (r ChainRoute) Dst() []string {
+	return r.dst
+}
+
+func (r ChainRoute) Index() int {
+	return r.index
+}
+
+// Hops returns how many hops the route has taken.
+func (r ChainRoute) Hops() int {
+	return r.hops
+}
+
+// HopLimit returns how many hops the route may take, DefaultHopLimit unless set.
+func (r ChainRoute) HopLimit() int {
+	if r.hopLimit <= 0 {
+		return DefaultHopLimit
+	}
+	return r.hopLimit
+}
+
+// WithHopLimit returns the route with its own hop limit.
+func (r ChainRoute) WithHopLimit(limit int) ChainRoute {
+	r.hopLimit = limit
+	return r
+}
+
+// WithHops returns the route having taken the given number of hops, for codecs.
+func (r ChainRoute) WithHops(hops int) ChainRoute {
+	r.hops = hops
+	return r
+}
+
+// Hop counts a hop, and reports false once the route has exceeded its hop limit.
+func (r ChainRoute) Hop() (Route, bool) {
+	r.hops++
+	return r, r.hops <= r.HopLimit()
+}
+
+// Rewind returns the route back at the source with no hops taken.
+func (r ChainRoute) Rewind() ChainRoute {
+	r.index = 0
+	r.hops = 0
+	return r
+}
+
 func (r ChainRoute) String() string {
 	var builder strings.Builder
 	builder.WriteString(magic.SeparatorBracketLeft)
@@ -83,11 +146,14 @@ func (r ChainRoute) Position() string {
 	return r.dst[r.index]
 }
 
+// Reverse returns the route back to the source, the hop limit is kept while the
+// hops start over.
 func (r ChainRoute) Reverse() Route {
 	return ChainRoute{
-		src:   r.dst,
-		dst:   r.src,
-		index: 0,
+		src:      r.dst,
+		dst:      r.src,
+		index:    0,
+		hopLimit: r.hopLimit,
 	}
 }
 
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"log"
 	"reflect"
-	"strings"
 	"time"
 
 	"github.com/acoderup/boost/device"
@@ -14,7 +13,6 @@ import (
 	"github.com/acoderup/boost/message"
 	"github.com/acoderup/boost/route"
 	"github.com/acoderup/boost/safe"
-	"github.com/acoderup/boost/style"
 )
 
 type Service struct {
@@ -80,19 +78,32 @@ func (s *Service) Init() {
 	s.init()
 }
 
+// route parses routePath under the router of the service, such as "/room/{roomID}/join"
+// for the handler Join under the router {roomID} of the router Room.
+func (s *Service) route(routePath string) (route.Route, error) {
+	r, err := route.ParsePattern(routePath)
+	if err != nil || len(r.Dst()) < 2 {
+		return nil, fmt.Errorf("invalid route path: %s", routePath)
+	}
+	return r.Under(device.Addr(s.router)).From(device.Addr(s.client)), nil
+}
+
 func (s *Service) Invoke(routePath string, req string) (rsp string) {
-	strs := strings.Split(routePath, "/")
-	if len(strs) < 2 {
-		return fmt.Errorf("error://invalid route path: %s", routePath).Error()
+	r, err := s.route(routePath)
+	if err != nil {
+		return fmt.Errorf("error://%w", err).Error()
 	}
 
 	if err := safe.DoWithTimeout(60*time.Second, func(ctx context.Context) error {
 		return s.client.Invoke(ctx, &message.Message{
-			Route: route.NewChainRoute(device.Addr(s.client),
-				append([]string{"", magic.Server, style.Standardize(strs[1], magic.SeparatorHyphen)}, strs[2:]...)),
+			Route:    r,
 			Encoding: encoding.NewJSON(),
 			Data:     []byte(req),
 		}, device.NewFuncProcessor(func(ctx context.Context, msg *message.Message) error {
+			if err := device.ErrorOf(msg); err != nil {
+				rsp = fmt.Errorf("error://%w", err).Error()
+				return nil
+			}
 			rsp = string(msg.Data)
 			return nil
 		}))
@@ -102,6 +113,21 @@ func (s *Service) Invoke(routePath string, req string) (rsp string) {
 	return
 }
 
+// Gather sends req to every instance of the handler group at routePath, see
+// device.Client.Gather, every call times out with the timeout of the service.
+func (s *Service) Gather(routePath string, req string, reducer device.Reducer) (*device.GatherResult, error) {
+	r, err := s.route(routePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.client.Gather(context.Background(), &message.Message{
+		Route:    r,
+		Encoding: encoding.NewJSON(),
+		Data:     []byte(req),
+	}, reducer, device.WithCallTimeout(s.Timeout))
+}
+
 func (s *Service) Close() {
 	s.close()
 }
@@ -2,6 +2,7 @@ package style
 
 import (
 	"strings"
+	"unicode"
 
 	"github.com/acoderup/boost/magic"
 )
@@ -73,6 +74,28 @@ func Standardize(s string, sep magic.SeparatorType) string {
 	return string(b)
 }
 
+// Destandardize splits a standardized name back into lower case words joined by sep,
+// runs of capitals are kept as one word, so "HTTPServer" becomes "http-server".
+func Destandardize(s string, sep magic.SeparatorType) string {
+	if s == "" || sep == magic.SeparatorLazy || sep == magic.SeparatorNone {
+		return s
+	}
+
+	runes := []rune(s)
+	var b strings.Builder
+	for index, r := range runes {
+		if index > 0 && unicode.IsUpper(r) {
+			prev := runes[index-1]
+			next := index+1 < len(runes) && unicode.IsLower(runes[index+1])
+			if !unicode.IsUpper(prev) || next {
+				b.WriteString(sep)
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
 type ChainStyle struct {
 	ChainSeperator magic.SeparatorType
 	WordSeparator  magic.SeparatorType
@@ -97,6 +120,15 @@ func (cs ChainStyle) Chain(s string) []string {
 	return chain
 }
 
+// Join is the reverse of Chain.
+func (cs ChainStyle) Join(chain []string) string {
+	words := make([]string, len(chain))
+	for index, name := range chain {
+		words[index] = Destandardize(name, cs.WordSeparator)
+	}
+	return strings.Join(words, cs.ChainSeperator)
+}
+
 func GoogleChain(s string) []string {
 	return Chain(s, googleChain)
 }
@@ -104,3 +136,11 @@ func GoogleChain(s string) []string {
 func UnixChain(s string) []string {
 	return Chain(s, unixChain)
 }
+
+func GooglePath(chain []string) string {
+	return googleChain.Join(chain)
+}
+
+func UnixPath(chain []string) string {
+	return unixChain.Join(chain)
+}
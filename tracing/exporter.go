@@ -0,0 +1,112 @@
+package tracing
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+// MemoryExporter keeps spans in memory, for tests and debugging.
+type MemoryExporter struct {
+	mutex sync.Mutex
+	spans []Span
+}
+
+func NewMemoryExporter() *MemoryExporter {
+	return &MemoryExporter{}
+}
+
+func (e *MemoryExporter) Export(span Span) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.spans = append(e.spans, span)
+	return nil
+}
+
+// Spans returns the spans in the order they have ended.
+func (e *MemoryExporter) Spans() []Span {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return append([]Span(nil), e.spans...)
+}
+
+// Trace returns the spans of a trace in the order they have started.
+func (e *MemoryExporter) Trace(traceID string) []Span {
+	var spans []Span
+	for _, span := range e.Spans() {
+		if span.TraceID == traceID {
+			spans = append(spans, span)
+		}
+	}
+	sort.SliceStable(spans, func(i, j int) bool {
+		return spans[i].Start.Before(spans[j].Start)
+	})
+	return spans
+}
+
+func (e *MemoryExporter) Reset() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.spans = nil
+}
+
+// JSONLinesExporter writes every span as a line of JSON.
+type JSONLinesExporter struct {
+	mutex   sync.Mutex
+	w       io.Writer
+	encoder *json.Encoder
+}
+
+func NewJSONLinesExporter(w io.Writer) *JSONLinesExporter {
+	return &JSONLinesExporter{
+		w:       w,
+		encoder: json.NewEncoder(w),
+	}
+}
+
+// OpenJSONLinesExporter appends spans to the file called filename.
+func OpenJSONLinesExporter(filename string) (*JSONLinesExporter, error) {
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return NewJSONLinesExporter(f), nil
+}
+
+func (e *JSONLinesExporter) Export(span Span) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return e.encoder.Encode(span)
+}
+
+// Close closes the writer if it is an io.Closer.
+func (e *JSONLinesExporter) Close() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if c, ok := e.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// ReadJSONLines reads the spans written by a JSONLinesExporter.
+func ReadJSONLines(r io.Reader) ([]Span, error) {
+	var spans []Span
+	decoder := json.NewDecoder(r)
+	for {
+		var span Span
+		if err := decoder.Decode(&span); err == io.EOF {
+			return spans, nil
+		} else if err != nil {
+			return spans, err
+		}
+		spans = append(spans, span)
+	}
+}
@@ -0,0 +1,83 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// Span is the timing of one hop of a message, spans of a request share its trace ID
+// and are linked by their parent IDs.
+type Span struct {
+	TraceID  string        `json:"trace_id"`
+	SpanID   string        `json:"span_id"`
+	ParentID string        `json:"parent_id,omitempty"`
+	Name     string        `json:"name"`
+	Kind     string        `json:"kind"`
+	Route    string        `json:"route,omitempty"`
+	Encoding string        `json:"encoding,omitempty"`
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// Exporter receives every span once it has ended.
+type Exporter interface {
+	Export(span Span) error
+}
+
+type Tracer struct {
+	exporters []Exporter
+}
+
+func NewTracer(exporters ...Exporter) *Tracer {
+	return &Tracer{
+		exporters: exporters,
+	}
+}
+
+// Start starts a span in the trace, or in a new trace when traceID is empty.
+func (t *Tracer) Start(traceID, parentID, name, kind string) *Span {
+	if traceID == "" {
+		traceID = NewID(16)
+	}
+	return &Span{
+		TraceID:  traceID,
+		SpanID:   NewID(8),
+		ParentID: parentID,
+		Name:     name,
+		Kind:     kind,
+		Start:    time.Now(),
+	}
+}
+
+// End records err on the span and exports it.
+func (t *Tracer) End(span *Span, err error) {
+	span.Duration = time.Since(span.Start)
+	if err != nil {
+		span.Error = err.Error()
+	}
+	for _, e := range t.exporters {
+		e.Export(*span)
+	}
+}
+
+// NewID returns n random bytes in hex.
+func NewID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+type contextKey struct{}
+
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, contextKey{}, span)
+}
+
+// SpanFrom returns the span of the hop being processed.
+func SpanFrom(ctx context.Context) *Span {
+	span, _ := ctx.Value(contextKey{}).(*Span)
+	return span
+}
@@ -0,0 +1,43 @@
+package tracing_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/acoderup/boost/tracing"
+)
+
+func TestExporters(t *testing.T) {
+	memory := tracing.NewMemoryExporter()
+	var buf bytes.Buffer
+	tracer := tracing.NewTracer(memory, tracing.NewJSONLinesExporter(&buf))
+
+	root := tracer.Start("", "", "root", "gateway")
+	child := tracer.Start(root.TraceID, root.SpanID, "child", "handler")
+	tracer.End(child, errors.New("boom"))
+	tracer.End(root, nil)
+	other := tracer.Start("", "", "other", "gateway")
+	tracer.End(other, nil)
+
+	spans := memory.Trace(root.TraceID)
+	if len(spans) != 2 || spans[0].Name != "root" || spans[1].ParentID != root.SpanID || spans[1].Error != "boom" {
+		t.Fatalf("unexpected trace %+v", spans)
+	}
+	if other.TraceID == root.TraceID {
+		t.Fatal("expecting a new trace")
+	}
+
+	lines, err := tracing.ReadJSONLines(&buf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(lines) != 3 || lines[0].SpanID != child.SpanID || lines[0].Error != "boom" {
+		t.Fatalf("unexpected lines %+v", lines)
+	}
+
+	memory.Reset()
+	if len(memory.Spans()) != 0 {
+		t.Fatal("expecting no span after reset")
+	}
+}